@@ -0,0 +1,26 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminAuthorized checks the request for the ADMIN_KEY as a bearer token, and
+// responds with 401 when it is missing or wrong. Admin endpoints are disabled
+// altogether when no ADMIN_KEY is configured.
+func adminAuthorized(c *gin.Context) bool {
+	adminKey := os.Getenv("ADMIN_KEY")
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if adminKey == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminKey)) != 1 {
+		message := "Not authorized"
+		log.Println(message)
+		c.JSON(http.StatusUnauthorized, ResponseStatus{message})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArtifactStore retains the outputs of a compilation under an opaque ID for a
+// limited time. Every artifact is a directory named by its ID, and it expires
+// ttl after the directory was created.
+type ArtifactStore struct {
+	dir string
+	ttl time.Duration
+}
+
+func NewArtifactStore(dir string, ttl time.Duration) *ArtifactStore {
+	return &ArtifactStore{dir: dir, ttl: ttl}
+}
+
+func (store *ArtifactStore) Enabled() bool {
+	return store != nil && store.dir != ""
+}
+
+// buildOutputs lists the regular files produced in the build directory.
+func buildOutputs(buildDir string) ([]string, error) {
+	entries, err := os.ReadDir(buildDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+// Retain moves the given files out of the build directory into a new artifact.
+func (store *ArtifactStore) Retain(buildDir string, files []string) (*ArtifactInfo, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	artifactDir := path.Join(store.dir, id.String())
+	err = os.MkdirAll(artifactDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		err = moveFile(path.Join(buildDir, file), path.Join(artifactDir, file))
+		if err != nil {
+			os.RemoveAll(artifactDir)
+			return nil, err
+		}
+	}
+	return &ArtifactInfo{
+		ID:        id.String(),
+		Files:     files,
+		ExpiresAt: time.Now().Add(store.ttl).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+var errNotRegularFile = errors.New("build output is not a regular file")
+
+// moveFile renames the file, or copies and removes it when the target is on
+// another filesystem, as ARTIFACTS_DIR and COMPILE_DIR may be. Symbolic links
+// are never followed, so only files the build itself wrote can be served.
+func moveFile(source string, target string) error {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errNotRegularFile
+	}
+	err = os.Rename(source, target)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	openedInfo, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, openedInfo) {
+		return errNotRegularFile
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Remove(source)
+}
+
+// Path returns the location of a file of an artifact that has not expired yet.
+func (store *ArtifactStore) Path(id string, file string) (string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return "", errors.New("Invalid artifact ID")
+	}
+	if file == "" || file != path.Base(file) || file == "." || file == ".." {
+		return "", errors.New("Invalid artifact file")
+	}
+	info, err := os.Stat(path.Join(store.dir, id))
+	if err != nil || time.Since(info.ModTime()) > store.ttl {
+		return "", errors.New("Artifact not found")
+	}
+	filePath := path.Join(store.dir, id, file)
+	fileInfo, err := os.Lstat(filePath)
+	if err != nil || !fileInfo.Mode().IsRegular() {
+		return "", errors.New("Artifact file not found")
+	}
+	return filePath, nil
+}
+
+func (store *ArtifactStore) removeExpired() {
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= store.ttl {
+			continue
+		}
+		err = os.RemoveAll(path.Join(store.dir, entry.Name()))
+		if err != nil {
+			log.Println("Error while removing expired artifact: ", err)
+		}
+	}
+}
+
+func (store *ArtifactStore) StartJanitor(interval time.Duration) {
+	if !store.Enabled() {
+		return
+	}
+	go func() {
+		for {
+			store.removeExpired()
+			time.Sleep(interval)
+		}
+	}()
+}
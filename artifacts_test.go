@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestArtifactsRejectSymlinks(t *testing.T) {
+	buildDir := t.TempDir()
+	secret := path.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path.Join(buildDir, "main"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	store := NewArtifactStore(t.TempDir(), time.Hour)
+	artifact, err := store.Retain(buildDir, []string{"main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Path(artifact.ID, "main"); err != nil {
+		t.Errorf("expected the retained file to be served, got %s", err)
+	}
+
+	if err := os.Symlink(secret, path.Join(buildDir, "swapped")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Retain(buildDir, []string{"swapped"}); err == nil {
+		t.Error("expected a symbolic link not to be retained")
+	}
+	if err := os.Symlink(secret, path.Join(store.dir, artifact.ID, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Path(artifact.ID, "linked"); err == nil {
+		t.Error("expected a symbolic link not to be served")
+	}
+}
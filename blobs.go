@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	SHA256  string
+	ETag    string
+	ModTime time.Time
+}
+
+// Blob is the content of a stored blob. Seeking is cheap, so that ranges of
+// the blob can be served without reading all of it.
+type Blob interface {
+	io.ReadSeekCloser
+	Info() BlobInfo
+}
+
+// BlobStore keeps uploaded files like release artifacts. Keys are slash
+// separated paths, validated with validBlobKey.
+type BlobStore interface {
+	// Put stores the content under the key, replacing any existing blob. The
+	// returned info has the SHA-256 checksum of the content.
+	Put(ctx context.Context, key string, content io.Reader) (BlobInfo, error)
+	// Open returns ErrNotFound if there is no blob with the key
+	Open(ctx context.Context, key string) (Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var errInvalidBlobKey = errors.New("invalid blob key")
+
+func validBlobKey(key string) bool {
+	if key == "" || len(key) > 512 || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || !releaseFileIDPattern.MatchString(segment) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewBlobStoreFromEnv returns the S3 store when BLOB_STORAGE is s3, and the
+// local store under blobsDir otherwise.
+func NewBlobStoreFromEnv(blobsDir string) BlobStore {
+	if os.Getenv("BLOB_STORAGE") == "s3" {
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return NewS3BlobStore(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET"), region,
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+	}
+	return &LocalBlobStore{dir: blobsDir}
+}
+
+// LocalBlobStore keeps blobs as files under dir
+type LocalBlobStore struct {
+	dir string
+}
+
+type localBlob struct {
+	*os.File
+	info BlobInfo
+}
+
+func (blob *localBlob) Info() BlobInfo {
+	return blob.info
+}
+
+func (store *LocalBlobStore) path(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", errInvalidBlobKey
+	}
+	return filepath.Join(store.dir, filepath.FromSlash(key)), nil
+}
+
+func localBlobETag(info os.FileInfo) string {
+	return `"` + strconv.FormatInt(info.Size(), 16) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 16) + `"`
+}
+
+// Put writes the content to a temporary file first, so that readers never see
+// a partially written blob.
+func (store *LocalBlobStore) Put(ctx context.Context, key string, content io.Reader) (BlobInfo, error) {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	err = os.MkdirAll(filepath.Dir(blobPath), 0755)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	file, err := os.CreateTemp(filepath.Dir(blobPath), ".upload-*")
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer os.Remove(file.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	err = os.Chmod(file.Name(), 0644)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	err = os.Rename(file.Name(), blobPath)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	stat, err := os.Stat(blobPath)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{
+		Key:     key,
+		Size:    stat.Size(),
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+		ETag:    localBlobETag(stat),
+		ModTime: stat.ModTime(),
+	}, nil
+}
+
+func (store *LocalBlobStore) Open(ctx context.Context, key string) (Blob, error) {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	file, err := os.Open(blobPath)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+	return &localBlob{File: file, info: BlobInfo{
+		Key:     key,
+		Size:    stat.Size(),
+		ETag:    localBlobETag(stat),
+		ModTime: stat.ModTime(),
+	}}, nil
+}
+
+func (store *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	blobPath, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(blobPath)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
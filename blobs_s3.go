@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3BlobStore keeps blobs in a bucket of an S3 compatible service, addressed
+// path style so that it also works with local stand-ins like MinIO.
+// Requests are signed with AWS Signature Version 4.
+type S3BlobStore struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func NewS3BlobStore(endpoint string, bucket string, region string, accessKey string, secretKey string) *S3BlobStore {
+	return &S3BlobStore{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		bucket:    bucket,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{},
+	}
+}
+
+// s3Escape encodes each segment of the path the way Signature Version 4
+// expects, keeping only unreserved characters and slashes.
+func s3Escape(value string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || strings.IndexByte("-_.~/", b) != -1 {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (store *S3BlobStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + store.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("AWS4"+store.secretKey), date)
+	key = hmacSHA256(key, store.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+store.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func (store *S3BlobStore) request(ctx context.Context, method string, key string, body io.Reader, size int64, payloadHash string, header http.Header) (*http.Response, error) {
+	if !validBlobKey(key) {
+		return nil, errInvalidBlobKey
+	}
+	objectURL, err := url.Parse(store.endpoint + "/" + store.bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	store.sign(req, payloadHash, time.Now())
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s request for %s failed with status code: %d", method, key, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// Put buffers the content in a temporary file, as the request has to be
+// signed with the checksum of the content before it is sent.
+func (store *S3BlobStore) Put(ctx context.Context, key string, content io.Reader) (BlobInfo, error) {
+	file, err := os.CreateTemp("", "blob-upload-*")
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	resp, err := store.request(ctx, http.MethodPut, key, file, size, checksum,
+		http.Header{"Content-Type": {"application/octet-stream"}})
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return BlobInfo{
+		Key:     key,
+		Size:    size,
+		SHA256:  checksum,
+		ETag:    resp.Header.Get("ETag"),
+		ModTime: time.Now(),
+	}, nil
+}
+
+func (store *S3BlobStore) Open(ctx context.Context, key string) (Blob, error) {
+	resp, err := store.request(ctx, http.MethodHead, key, nil, 0, emptyPayloadHash, nil)
+	if err == errInvalidBlobKey {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &s3Blob{ctx: ctx, store: store, info: BlobInfo{
+		Key:     key,
+		Size:    resp.ContentLength,
+		ETag:    resp.Header.Get("ETag"),
+		ModTime: modTime,
+	}}, nil
+}
+
+func (store *S3BlobStore) Delete(ctx context.Context, key string) error {
+	resp, err := store.request(ctx, http.MethodDelete, key, nil, 0, emptyPayloadHash, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// s3Blob only requests the content once it is read, starting from the offset
+// it was seeked to, so serving a range downloads only that range.
+type s3Blob struct {
+	ctx    context.Context
+	store  *S3BlobStore
+	info   BlobInfo
+	offset int64
+	body   io.ReadCloser
+}
+
+func (blob *s3Blob) Info() BlobInfo {
+	return blob.info
+}
+
+func (blob *s3Blob) Read(p []byte) (int, error) {
+	if blob.offset >= blob.info.Size {
+		return 0, io.EOF
+	}
+	if blob.body == nil {
+		resp, err := blob.store.request(blob.ctx, http.MethodGet, blob.info.Key, nil, 0, emptyPayloadHash,
+			http.Header{"Range": {"bytes=" + strconv.FormatInt(blob.offset, 10) + "-"}})
+		if err != nil {
+			return 0, err
+		}
+		blob.body = resp.Body
+	}
+	n, err := blob.body.Read(p)
+	blob.offset += int64(n)
+	return n, err
+}
+
+func (blob *s3Blob) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += blob.offset
+	case io.SeekEnd:
+		offset += blob.info.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before the start of the blob")
+	}
+	if offset != blob.offset && blob.body != nil {
+		blob.body.Close()
+		blob.body = nil
+	}
+	blob.offset = offset
+	return offset, nil
+}
+
+func (blob *s3Blob) Close() error {
+	if blob.body != nil {
+		return blob.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var compileFlags = []string{"--no-colors"}
+
+func compilerBinary() string {
+	if len(os.Args) >= 3 {
+		return path.Join(os.Args[2], "qat")
+	}
+	return "qat"
+}
+
+// sourceFiles returns the files of the request keyed by their cleaned relative
+// paths, along with the entry point. Requests carrying only Content are treated
+// as a project with a single main.qat file.
+func sourceFiles(qatFile NewCompileFile) (map[string]string, string, error) {
+	if len(qatFile.Files) == 0 {
+		return map[string]string{"main.qat": qatFile.Content}, "main.qat", nil
+	}
+	if len(qatFile.Files) > envInt("COMPILE_MAX_FILES", 64) {
+		return nil, "", errors.New("Too many files in the project")
+	}
+	files := make(map[string]string, len(qatFile.Files))
+	totalSize := 0
+	for name, content := range qatFile.Files {
+		cleaned, err := cleanSourcePath(name)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, exists := files[cleaned]; exists {
+			return nil, "", errors.New("Duplicate file path " + name)
+		}
+		files[cleaned] = content
+		totalSize += len(content)
+	}
+	if totalSize > envInt("COMPILE_MAX_SOURCE_KB", 512)*1024 {
+		return nil, "", errors.New("Project sources are too large")
+	}
+	entryPoint := qatFile.EntryPoint
+	if entryPoint == "" {
+		entryPoint = "main.qat"
+	}
+	entryPoint, err := cleanSourcePath(entryPoint)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, exists := files[entryPoint]; !exists {
+		return nil, "", errors.New("Entry point " + entryPoint + " is not one of the project files")
+	}
+	return files, entryPoint, nil
+}
+
+func cleanSourcePath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "\\\x00") || path.IsAbs(name) {
+		return "", errors.New("Invalid file path " + name)
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.New("Invalid file path " + name)
+	}
+	return cleaned, nil
+}
+
+// mapProblemFiles rewrites the paths reported by the compiler for files in the
+// source directory back to the relative paths they were submitted with.
+func mapProblemFiles(problems []Problem, srcDir string) {
+	prefixes := srcDirPrefixes(srcDir)
+	for i := range problems {
+		file := filepath.ToSlash(problems[i].FileRange.File)
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(file, prefix) {
+				problems[i].FileRange.File = strings.TrimPrefix(file, prefix)
+				break
+			}
+		}
+	}
+}
+
+func srcDirPrefixes(srcDir string) []string {
+	prefixes := []string{srcDir + "/"}
+	if absSrcDir, err := filepath.Abs(srcDir); err == nil {
+		// The absolute path goes first, since it may end with the relative one
+		prefixes = append([]string{filepath.ToSlash(absSrcDir) + "/"}, prefixes...)
+	}
+	return prefixes
+}
+
+// compileOutput reports the output of the compiler to the event listener line
+// by line. The compiler does not announce its phases, so the first line that
+// mentions linking is taken as the switch from compiling to linking. Paths
+// of the source directory are made relative like in mapProblemFiles, so that
+// the layout of the server is not exposed.
+type compileOutput struct {
+	mu       sync.Mutex
+	events   func(CompileEvent)
+	prefixes []string
+	linking  bool
+}
+
+func (o *compileOutput) emit(stream string, line string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.linking && strings.Contains(strings.ToLower(line), "linking") {
+		o.linking = true
+		o.events(CompileEvent{Phase: CompilePhaseLinking})
+	}
+	for _, prefix := range o.prefixes {
+		line = strings.ReplaceAll(line, prefix, "")
+	}
+	o.events(CompileEvent{Stream: stream, Line: line})
+}
+
+type lineWriter struct {
+	stream  string
+	output  *compileOutput
+	pending []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.pending = append(w.pending, p...)
+	for {
+		index := bytes.IndexByte(w.pending, '\n')
+		if index < 0 {
+			break
+		}
+		w.output.emit(w.stream, string(bytes.TrimRight(w.pending[:index], "\r")))
+		w.pending = w.pending[index+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) Flush() {
+	if len(w.pending) > 0 {
+		w.output.emit(w.stream, string(w.pending))
+		w.pending = nil
+	}
+}
+
+// runWithContext runs the command in its own process group and kills the whole
+// group once ctx is done, so that nothing the compiler spawned outlives it.
+func runWithContext(ctx context.Context, cmd *exec.Cmd) error {
+	setProcessGroup(cmd)
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		killProcessGroup(cmd)
+		<-done
+		return ctx.Err()
+	}
+}
+
+func compileSource(ctx context.Context, qatFile NewCompileFile, toolchain Toolchain, artifacts *ArtifactStore, events func(CompileEvent)) (*SystemCompileResult, error) {
+	timeout := time.Duration(envInt("COMPILE_TIMEOUT_SECONDS", 30)) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	uniq, err := uuid.NewUUID()
+	if err != nil {
+		message := "Cannot get UUID directory"
+		log.Println(message)
+		return nil, errors.New(message)
+	}
+	var dir string
+	if len(os.Args) != 2 {
+		dir = path.Join(os.Getenv("COMPILE_DIR"), uniq.String())
+	} else {
+		dir = path.Join(os.Args[1], os.Getenv("COMPILE_DIR"), uniq.String())
+	}
+	defer os.RemoveAll(dir)
+	files, entryPoint, err := sourceFiles(qatFile)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+	buildDir := path.Join(dir, "build")
+	srcDir := path.Join(dir, "src")
+	mainFile := path.Join(srcDir, entryPoint)
+	err = os.MkdirAll(buildDir, 0755)
+	if err != nil {
+		message := "Cannot create build directory"
+		log.Println(message)
+		return nil, errors.New(message)
+	}
+	for name, content := range files {
+		err = os.MkdirAll(path.Join(srcDir, path.Dir(name)), 0755)
+		if err != nil {
+			message := "Cannot create source directory"
+			log.Println(message)
+			return nil, errors.New(message)
+		}
+		err = os.WriteFile(path.Join(srcDir, name), []byte(content), 0755)
+		if err != nil {
+			message := "Cannot write contents to file for compile"
+			log.Println(message)
+			return nil, errors.New(message)
+		}
+	}
+	cmd := exec.Command(toolchain.Binary, append([]string{"build", mainFile, "-o", buildDir}, compileFlags...)...)
+	var stdout, stderr *lineWriter
+	if events != nil {
+		events(CompileEvent{Phase: CompilePhaseCompiling})
+		output := &compileOutput{events: events, prefixes: srcDirPrefixes(srcDir)}
+		stdout = &lineWriter{stream: "stdout", output: output}
+		stderr = &lineWriter{stream: "stderr", output: output}
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+	}
+	err = runWithContext(ctx, cmd)
+	if events != nil {
+		stdout.Flush()
+		stderr.Flush()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		message := "Compilation timed out after " + timeout.String()
+		log.Println(message)
+		return &SystemCompileResult{
+			Problems: []Problem{{IsError: true, Message: message}},
+			Status:   false,
+			TimedOut: true,
+			Compiler: toolchain.ReleaseID,
+		}, nil
+	}
+	if err != nil {
+		message := "Running compiler failed: " + err.Error()
+		log.Println(message)
+		return nil, errors.New(message)
+	}
+	_, err = os.Stat(path.Join(buildDir, "QatCompilationResult.json"))
+	if err != nil {
+		message := "Result file does not exist"
+		log.Println(message)
+		return nil, errors.New(message)
+	}
+	resContent, err := os.ReadFile(path.Join(buildDir, "QatCompilationResult.json"))
+	if err != nil {
+		message := "Reading result file failed"
+		log.Println(message)
+		return nil, errors.New(message)
+	}
+	var sysCompRes SystemCompileResult
+	err = json.Unmarshal(resContent, &sysCompRes)
+	if err != nil {
+		message := "Parsing result file failed"
+		log.Println(message)
+		return nil, errors.New(message)
+	}
+	mapProblemFiles(sysCompRes.Problems, srcDir)
+	sysCompRes.Compiler = toolchain.ReleaseID
+	var outputs []string
+	if qatFile.KeepArtifacts && sysCompRes.Status && artifacts.Enabled() {
+		outputs, err = buildOutputs(buildDir)
+		if err != nil {
+			message := "Could not list the build outputs"
+			log.Println(message)
+			return nil, errors.New(message)
+		}
+	}
+	if qatFile.Run && sysCompRes.Status && sysCompRes.HasMain {
+		binary, err := findBinary(buildDir)
+		if err != nil {
+			message := "Could not find the compiled program to run"
+			log.Println(message)
+			return nil, errors.New(message)
+		}
+		if events != nil {
+			events(CompileEvent{Phase: CompilePhaseRunning})
+		}
+		sysCompRes.Run, err = runSandboxed(ctx, binary, sandboxLimitsFromEnv())
+		if err != nil {
+			message := "Running the compiled program failed: " + err.Error()
+			log.Println(message)
+			return nil, errors.New(message)
+		}
+	}
+	if outputs != nil {
+		sysCompRes.Artifacts, err = artifacts.Retain(buildDir, outputs)
+		if err != nil {
+			message := "Could not retain the build artifacts: " + err.Error()
+			log.Println(message)
+			return nil, errors.New(message)
+		}
+	}
+	return &sysCompRes, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type compileCacheEntry struct {
+	key    string
+	result SystemCompileResult
+}
+
+// CompileCache is an LRU of compile results keyed by the hash of everything
+// that affects the output of the compiler. When a store is provided, entries
+// are also persisted there so that they survive restarts.
+type CompileCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	store    CompileResultStore
+}
+
+func NewCompileCache(capacity int, store CompileResultStore) *CompileCache {
+	return &CompileCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		store:    store,
+	}
+}
+
+// compilerFingerprint identifies the compiler binary by its location, size and
+// modification time, so that upgrading the compiler invalidates the cache.
+func compilerFingerprint(compiler string) string {
+	binary, err := exec.LookPath(compiler)
+	if err != nil {
+		return compiler
+	}
+	info, err := os.Stat(binary)
+	if err != nil {
+		return binary
+	}
+	return fmt.Sprintf("%s:%d:%d", binary, info.Size(), info.ModTime().UnixNano())
+}
+
+func compileCacheKey(toolchain Toolchain, files map[string]string, entryPoint string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "compiler=%s:%s\n", toolchain.ReleaseID, compilerFingerprint(toolchain.Binary))
+	fmt.Fprintf(hash, "flags=%s\n", strings.Join(compileFlags, " "))
+	fmt.Fprintf(hash, "entry=%s\n", entryPoint)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(hash, "file=%s:%d\n", name, len(files[name]))
+		hash.Write([]byte(files[name]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// canUseCachedResult reports whether the cached result answers the request on
+// its own. Running the program or keeping the artifacts needs a fresh build
+// whenever the cached compilation succeeded.
+func canUseCachedResult(qatFile NewCompileFile, cached *SystemCompileResult) bool {
+	if !cached.Status {
+		return true
+	}
+	return !(qatFile.Run && cached.HasMain) && !qatFile.KeepArtifacts
+}
+
+func (cache *CompileCache) Get(key string) (*SystemCompileResult, bool) {
+	if cache.capacity <= 0 && cache.store == nil {
+		return nil, false
+	}
+	cache.mu.Lock()
+	if elem, ok := cache.entries[key]; ok {
+		cache.order.MoveToFront(elem)
+		result := elem.Value.(*compileCacheEntry).result
+		cache.mu.Unlock()
+		return &result, true
+	}
+	cache.mu.Unlock()
+	if cache.store == nil {
+		return nil, false
+	}
+	stored, err := cache.store.Get(context.Background(), key)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println("Error while looking up cached compile result: ", err)
+		}
+		return nil, false
+	}
+	cache.remember(key, *stored)
+	return stored, true
+}
+
+func (cache *CompileCache) Put(key string, result SystemCompileResult) {
+	if result.TimedOut {
+		return
+	}
+	result.Run = nil
+	result.Artifacts = nil
+	result.Queue = nil
+	result.Cached = false
+	cache.remember(key, result)
+	if cache.store == nil {
+		return
+	}
+	err := cache.store.Put(context.Background(), key, result)
+	if err != nil {
+		log.Println("Error while persisting compile result to the cache: ", err)
+	}
+}
+
+func (cache *CompileCache) remember(key string, result SystemCompileResult) {
+	if cache.capacity <= 0 {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if elem, ok := cache.entries[key]; ok {
+		elem.Value.(*compileCacheEntry).result = result
+		cache.order.MoveToFront(elem)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&compileCacheEntry{key: key, result: result})
+	for cache.order.Len() > cache.capacity {
+		oldest := cache.order.Back()
+		cache.order.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*compileCacheEntry).key)
+	}
+}
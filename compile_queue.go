@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var errCompileQueueFull = errors.New("compile queue is full")
+
+type compileJob struct {
+	ctx        context.Context
+	file       NewCompileFile
+	toolchain  Toolchain
+	events     func(CompileEvent)
+	position   int
+	enqueuedAt time.Time
+	startedAt  time.Time
+	result     *SystemCompileResult
+	err        error
+	// queued is closed once the queued event has been sent
+	queued chan struct{}
+	done   chan struct{}
+}
+
+// CompileQueue bounds the number of compiler processes running at once. Jobs
+// wait in a fixed size buffer and are picked up by a pool of workers, and a
+// submission is rejected outright when the buffer is already full.
+type CompileQueue struct {
+	jobs       chan *compileJob
+	mu         sync.Mutex
+	workers    int
+	retryAfter time.Duration
+	artifacts  *ArtifactStore
+}
+
+func NewCompileQueue(workers int, depth int, retryAfter time.Duration, artifacts *ArtifactStore) *CompileQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 0 {
+		depth = 0
+	}
+	queue := &CompileQueue{
+		jobs:       make(chan *compileJob, depth),
+		workers:    workers,
+		retryAfter: retryAfter,
+		artifacts:  artifacts,
+	}
+	for i := 0; i < workers; i++ {
+		go queue.work()
+	}
+	log.Printf("Started compile queue with %d workers and a depth of %d", workers, depth)
+	return queue
+}
+
+func (q *CompileQueue) work() {
+	for job := range q.jobs {
+		// Wait for the queued event, so that it reaches the listener first
+		<-job.queued
+		job.startedAt = time.Now()
+		if job.ctx.Err() != nil {
+			job.err = job.ctx.Err()
+		} else {
+			job.result, job.err = compileSource(job.ctx, job.file, job.toolchain, q.artifacts, job.events)
+		}
+		close(job.done)
+	}
+}
+
+// Submit places the file in the queue and blocks until a worker has compiled
+// it or ctx is cancelled. The returned QueueInfo reports the position the job
+// was given when it was enqueued and how long it waited for a worker.
+func (q *CompileQueue) Submit(ctx context.Context, file NewCompileFile, toolchain Toolchain) (*SystemCompileResult, *QueueInfo, error) {
+	job, err := q.Enqueue(ctx, file, toolchain, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return q.Wait(ctx, job)
+}
+
+// Enqueue places the file in the queue without waiting for it to be compiled.
+// Progress of the job is reported to events when it is not nil.
+func (q *CompileQueue) Enqueue(ctx context.Context, file NewCompileFile, toolchain Toolchain, events func(CompileEvent)) (*compileJob, error) {
+	job := &compileJob{
+		ctx:        ctx,
+		file:       file,
+		toolchain:  toolchain,
+		events:     events,
+		enqueuedAt: time.Now(),
+		queued:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	q.mu.Lock()
+	job.position = len(q.jobs) + 1
+	select {
+	case q.jobs <- job:
+		q.mu.Unlock()
+	default:
+		q.mu.Unlock()
+		return nil, errCompileQueueFull
+	}
+	if events != nil {
+		events(CompileEvent{Phase: CompilePhaseQueued, Position: job.position})
+	}
+	close(job.queued)
+	return job, nil
+}
+
+func (q *CompileQueue) Wait(ctx context.Context, job *compileJob) (*SystemCompileResult, *QueueInfo, error) {
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	info := &QueueInfo{
+		Position: job.position,
+		WaitTime: job.startedAt.Sub(job.enqueuedAt).Milliseconds(),
+	}
+	return job.result, info, job.err
+}
+
+func (q *CompileQueue) RetryAfter() time.Duration {
+	return q.retryAfter
+}
+
+func (q *CompileQueue) Artifacts() *ArtifactStore {
+	return q.artifacts
+}
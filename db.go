@@ -18,8 +18,19 @@ func ConnectDB(collections *Collections) {
 	db := client.Database(os.Getenv("DB_NAME"))
 	log.Println("Connected to database")
 	collections.Releases = db.Collection(os.Getenv("RELEASES_COLLECTION"))
+	err = ensureReleaseIndexes(collections.Releases)
+	if err != nil {
+		log.Fatal("Could not create the release indexes, check that release IDs and indexes are unique: ", err)
+	}
 	collections.Updates = db.Collection(os.Getenv("UPDATES_COLLECTION"))
 	collections.Commits = db.Collection(os.Getenv("COMMITS_COLLECTION"))
 	collections.Config = db.Collection(os.Getenv("CONFIG_COLLECTION"))
+	collections.Snippets = db.Collection(os.Getenv("SNIPPETS_COLLECTION"))
+	ensureSnippetIndexes(collections.Snippets)
+	collections.StatsHistory = db.Collection(os.Getenv("STATS_HISTORY_COLLECTION"))
+	ensureStatsHistoryIndexes(collections.StatsHistory)
+	if os.Getenv("COMPILE_CACHE_COLLECTION") != "" {
+		collections.CompileCache = db.Collection(os.Getenv("COMPILE_CACHE_COLLECTION"))
+	}
 	log.Println("Got all database collections")
 }
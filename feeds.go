@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const feedEntryLimit = 30
+
+var feedContentTypes = map[string]string{
+	"atom": "application/atom+xml; charset=utf-8",
+	"rss":  "application/rss+xml; charset=utf-8",
+	"json": "application/feed+json; charset=utf-8",
+}
+
+type feedAttachment struct {
+	URL   string
+	Title string
+	Size  int64
+}
+
+// feedEntry is updated when it was last changed, or the zero time if it has
+// not been changed since it was published
+type feedEntry struct {
+	ID          string
+	Title       string
+	Content     string
+	Published   time.Time
+	Updated     time.Time
+	Attachments []feedAttachment
+}
+
+// feed is rendered as Atom, RSS 2.0 or JSON Feed. The entries are ordered
+// from the newest, and Updated is the last time any of them was published or
+// changed.
+type feed struct {
+	Title       string
+	Description string
+	HomeURL     string
+	FeedURL     string
+	Updated     time.Time
+	Entries     []feedEntry
+}
+
+func websiteURL() string {
+	if url := os.Getenv("WEBSITE_URL"); url != "" {
+		return url
+	}
+	return "https://qat.dev"
+}
+
+// parseFeedTime returns the zero time for creation times that were not
+// stored in RFC 3339 form
+func parseFeedTime(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed.UTC()
+}
+
+func newFeed(title string, description string, feedURL string, entries []feedEntry) feed {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Published.After(entries[j].Published)
+	})
+	if len(entries) > feedEntryLimit {
+		entries = entries[:feedEntryLimit]
+	}
+	updated := time.Unix(0, 0).UTC()
+	for _, entry := range entries {
+		if entry.Published.After(updated) {
+			updated = entry.Published
+		}
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+	}
+	return feed{
+		Title:       title,
+		Description: description,
+		HomeURL:     websiteURL(),
+		FeedURL:     feedURL,
+		Updated:     updated,
+		Entries:     entries,
+	}
+}
+
+func releaseFeedEntries(releases []LanguageRelease, baseURL string) []feedEntry {
+	entries := make([]feedEntry, 0, len(releases))
+	for _, release := range releases {
+		title := release.Title
+		if title == "" {
+			title = "qat " + release.Version.Value
+		}
+		entry := feedEntry{
+			ID:        baseURL + "/feeds/releases#" + release.ReleaseID,
+			Title:     title,
+			Content:   release.Content,
+			Published: parseFeedTime(release.CreatedAt),
+			Updated:   parseFeedTime(release.UpdatedAt),
+		}
+		for _, file := range release.Files {
+			entry.Attachments = append(entry.Attachments, feedAttachment{
+				URL:   baseURL + "/download/" + release.ReleaseID + "/" + file.Id,
+				Title: releaseFileName(file),
+				Size:  file.Size,
+			})
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func updateFeedEntries(updates []LanguageUpdate, baseURL string) []feedEntry {
+	entries := make([]feedEntry, 0, len(updates))
+	for _, update := range updates {
+		entries = append(entries, feedEntry{
+			ID:        baseURL + "/feeds/updates#" + strconv.Itoa(update.Index),
+			Title:     update.Title,
+			Content:   update.Content,
+			Published: parseFeedTime(update.CreatedAt),
+		})
+	}
+	return entries
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (f feed) atom() ([]byte, error) {
+	result := atomFeed{
+		ID:    f.FeedURL,
+		Title: f.Title,
+		Links: []atomLink{
+			{Href: f.HomeURL},
+			{Href: f.FeedURL, Rel: "self", Type: feedContentTypes["atom"]},
+		},
+		Updated: f.Updated.Format(time.RFC3339),
+		Author:  "qat",
+	}
+	for _, entry := range f.Entries {
+		updated := entry.Published
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+		if updated.IsZero() {
+			updated = f.Updated
+		}
+		item := atomEntry{
+			ID:      entry.ID,
+			Title:   entry.Title,
+			Updated: updated.Format(time.RFC3339),
+			Links:   []atomLink{{Href: entry.ID}},
+			Content: atomText{Type: "text", Body: entry.Content},
+		}
+		if !entry.Published.IsZero() {
+			item.Published = entry.Published.Format(time.RFC3339)
+		}
+		for _, attachment := range entry.Attachments {
+			item.Links = append(item.Links, atomLink{
+				Href:   attachment.URL,
+				Rel:    "enclosure",
+				Type:   "application/octet-stream",
+				Title:  attachment.Title,
+				Length: attachment.Size,
+			})
+		}
+		result.Entries = append(result.Entries, item)
+	}
+	return marshalFeedXML(result)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	GUID        rssGUID `xml:"guid"`
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// rss leaves out the files of releases, since an RSS item can only have a
+// single enclosure
+func (f feed) rss() ([]byte, error) {
+	channel := rssChannel{
+		Title:         f.Title,
+		Link:          f.HomeURL,
+		Description:   f.Description,
+		Self:          atomLink{Href: f.FeedURL, Rel: "self", Type: feedContentTypes["rss"]},
+		LastBuildDate: f.Updated.Format(time.RFC1123Z),
+	}
+	for _, entry := range f.Entries {
+		item := rssItem{
+			GUID:        rssGUID{IsPermaLink: false, Value: entry.ID},
+			Title:       entry.Title,
+			Link:        entry.ID,
+			Description: entry.Content,
+		}
+		if !entry.Published.IsZero() {
+			item.PubDate = entry.Published.Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return marshalFeedXML(rssFeed{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", Channel: channel})
+}
+
+func marshalFeedXML(value interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(value, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	Title       string `json:"title,omitempty"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	DatePublished string               `json:"date_published,omitempty"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+func (f feed) json() ([]byte, error) {
+	result := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.HomeURL,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Items:       []jsonFeedItem{},
+	}
+	for _, entry := range f.Entries {
+		item := jsonFeedItem{
+			ID:          entry.ID,
+			URL:         entry.ID,
+			Title:       entry.Title,
+			ContentText: entry.Content,
+		}
+		if !entry.Published.IsZero() {
+			item.DatePublished = entry.Published.Format(time.RFC3339)
+		}
+		if !entry.Updated.IsZero() {
+			item.DateModified = entry.Updated.Format(time.RFC3339)
+		}
+		for _, attachment := range entry.Attachments {
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{
+				URL:         attachment.URL,
+				MimeType:    "application/octet-stream",
+				Title:       attachment.Title,
+				SizeInBytes: attachment.Size,
+			})
+		}
+		result.Items = append(result.Items, item)
+	}
+	return json.MarshalIndent(result, "", "\t")
+}
+
+// serveFeed renders the feed in the format asked for with the format query,
+// Atom by default. The ETag is a hash of the rendered feed, so readers polling
+// with If-None-Match get a 304 until anything in the feed changes. Last-Modified
+// is the last time an entry of the feed was published or changed, for readers
+// that only send If-Modified-Since.
+func serveFeed(c *gin.Context, format string, f feed) {
+	var body []byte
+	var err error
+	switch format {
+	case "atom":
+		body, err = f.atom()
+	case "rss":
+		body, err = f.rss()
+	case "json":
+		body, err = f.json()
+	}
+	if err != nil {
+		message := "Could not generate the feed"
+		log.Println(message, err)
+		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+		return
+	}
+	hash := sha256.Sum256(body)
+	c.Header("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+	c.Header("Content-Type", feedContentTypes[format])
+	c.Header("Cache-Control", "public, max-age=300")
+	http.ServeContent(c.Writer, c.Request, "", f.Updated, bytes.NewReader(body))
+}
+
+func readFeedFormat(c *gin.Context) (string, bool) {
+	format := c.DefaultQuery("format", "atom")
+	if _, ok := feedContentTypes[format]; !ok {
+		message := "Feed format should be atom, rss or json"
+		log.Println(message)
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return "", false
+	}
+	return format, true
+}
+
+func releaseFeedHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		format, ok := readFeedFormat(c)
+		if !ok {
+			return
+		}
+		published, err := releases.List(c.Request.Context(), ReleaseQuery{})
+		if err != nil {
+			message := "Unable to find releases"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		baseURL := requestBaseURL(c)
+		serveFeed(c, format, newFeed(
+			"qat releases",
+			"New releases of the qat compiler",
+			baseURL+"/feeds/releases?format="+format,
+			releaseFeedEntries(published, baseURL),
+		))
+	}
+}
+
+func updateFeedHandler(updates UpdateStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		format, ok := readFeedFormat(c)
+		if !ok {
+			return
+		}
+		all, err := updates.List(c.Request.Context())
+		if err != nil {
+			message := "Unable to find updates"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		baseURL := requestBaseURL(c)
+		serveFeed(c, format, newFeed(
+			"qat updates",
+			"News about the qat language",
+			baseURL+"/feeds/updates?format="+format,
+			updateFeedEntries(all, baseURL),
+		))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReleaseFeedCaching(t *testing.T) {
+	stores := newTestStores()
+	r := newTestRouter(stores)
+	r.GET("/feeds/releases", releaseFeedHandler(stores.Releases))
+
+	w := serve(r, "GET", "/feeds/releases?format=json", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "v0.4.0") {
+		t.Errorf("expected drafts not to be in the feed")
+	}
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if etag == "" || lastModified != "Thu, 01 Jan 2026 00:00:00 GMT" {
+		t.Fatalf("unexpected ETag %q and Last-Modified %q", etag, lastModified)
+	}
+	if w := serve(r, "GET", "/feeds/releases?format=json", "", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for the same ETag, got %d", w.Code)
+	}
+	if w := serve(r, "GET", "/feeds/releases?format=json", "", map[string]string{"If-Modified-Since": lastModified}); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 when nothing changed since, got %d", w.Code)
+	}
+
+	before := time.Now().UTC().Truncate(time.Second)
+	if err := stores.Releases.SetDraft(context.Background(), "v0.4.0", false); err != nil {
+		t.Fatal(err)
+	}
+	w = serve(r, "GET", "/feeds/releases?format=json", "", map[string]string{"If-Modified-Since": lastModified})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "v0.4.0") {
+		t.Fatalf("expected the published release after it was published, got %d", w.Code)
+	}
+	modified, err := http.ParseTime(w.Header().Get("Last-Modified"))
+	if err != nil || modified.Before(before) || w.Header().Get("ETag") == etag {
+		t.Errorf("expected a new ETag and Last-Modified, got %q and %q", w.Header().Get("ETag"), w.Header().Get("Last-Modified"))
+	}
+}
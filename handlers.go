@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,154 +8,471 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func releaseListHandler(collections *Collections) gin.HandlerFunc {
+// readJSONBody decodes the request body into value, writing the error
+// response itself when the body cannot be decoded.
+func readJSONBody(c *gin.Context, value interface{}) bool {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		message := "Error reading request body with error: " + err.Error()
+		log.Println(message)
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return false
+	}
+	err = json.Unmarshal(body, value)
+	if err != nil {
+		message := "Could not decode request body to JSON with error: " + err.Error()
+		log.Println(message)
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return false
+	}
+	return true
+}
+
+// readReleaseSelection reads the channel, version constraint and file filters
+// that releases are selected by, writing the error response itself when they
+// are invalid. The prerelease parameter picks the channel if none is given.
+func readReleaseSelection(c *gin.Context, defaultChannel string) (releaseSelection, bool) {
+	selection := releaseSelection{channel: c.Query("channel")}
+	if selection.channel == "" {
+		switch c.Query("prerelease") {
+		case "":
+			selection.channel = defaultChannel
+		case "true":
+			selection.channel = "prerelease"
+		case "false":
+			selection.channel = "stable"
+		}
+	}
+	if releaseChannels[selection.channel] == nil {
+		message := "Channel should be stable, prerelease or all"
+		log.Println(message)
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return selection, false
+	}
+	if c.Query("constraint") != "" {
+		var err error
+		selection.constraint, err = ParseVersionConstraint(c.Query("constraint"))
+		if err != nil {
+			message := "Invalid version constraint: " + err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return selection, false
+		}
+	}
+	selection.query = ReleaseQuery{
+		Platform:       c.Query("platform"),
+		Architecture:   c.Query("architecture"),
+		Target:         c.Query("target"),
+		WithoutContent: true,
+	}
+	return selection, true
+}
+
+func releaseListHandler(releases ReleaseStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
 		c.Header("Access-Control-Max-Age", "15")
-		cur, err := collections.Releases.Find(context.Background(), bson.M{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ResponseStatus{"Unable to find releases"})
+		selection, ok := readReleaseSelection(c, "all")
+		if !ok {
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 100 {
+			message := "Limit should be a number from 1 to 100"
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
 		}
 		var result struct {
-			Releases []LanguageRelease `json:"releases"`
+			Releases   []LanguageRelease `json:"releases"`
+			Pagination ReleasePage       `json:"pagination"`
 		}
-		for cur.Next(context.Background()) {
-			var item bson.D
-			if err := cur.Decode(&item); err != nil {
-				log.Println("Error while decoding bson: ", err)
-				continue
-			}
-			itemBytes, err := bson.Marshal(item)
+		selected, err := selectReleases(c.Request.Context(), releases, selection)
+		if err != nil {
+			message := "Unable to find releases"
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		result.Releases, result.Pagination, err = releasePage(selected, c.Query("cursor"), limit)
+		if err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		if c.Query("content") != "false" {
+			err = fillReleaseContent(c.Request.Context(), releases, result.Releases)
 			if err != nil {
-				log.Println("Error converting item to json: ", err)
-				continue
+				message := "Unable to find releases"
+				log.Println(message)
+				c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+				return
 			}
-			var rlsItem LanguageRelease
-			bson.Unmarshal(itemBytes, &rlsItem)
-			result.Releases = append(result.Releases, rlsItem)
 		}
 		c.JSON(http.StatusOK, result)
 	}
 }
 
-func compileHandler(c *gin.Context) {
-	c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
-	c.Header("Access-Control-Max-Age", "15")
+func latestReleaseHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		selection, ok := readReleaseSelection(c, "stable")
+		if !ok {
+			return
+		}
+		selected, err := selectReleases(c.Request.Context(), releases, selection)
+		if err != nil {
+			message := "Unable to find releases"
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		if len(selected) == 0 {
+			message := "No release matches the query"
+			log.Println(message)
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		latest := selected[:1]
+		if c.Query("content") != "false" {
+			err = fillReleaseContent(c.Request.Context(), releases, latest)
+			if err != nil {
+				message := "Unable to find releases"
+				log.Println(message)
+				c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, latest[0])
+	}
+}
+
+// readCompileRequest decodes and validates a compile request, writing the error
+// response itself when the request cannot be compiled.
+func readCompileRequest(c *gin.Context, queue *CompileQueue, toolchains *ToolchainRegistry) (NewCompileFile, Toolchain, string, bool) {
 	var qatFile NewCompileFile
 	compReq, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		message := "Error reading request body with error: " + err.Error()
 		log.Println(message)
 		c.JSON(http.StatusBadRequest, ResponseStatus{message})
-		return
+		return qatFile, Toolchain{}, "", false
 	}
 	err = json.Unmarshal(compReq, &qatFile)
 	if err != nil {
 		message := "Could not decode request body to JSON with error: " + err.Error()
 		log.Println(message)
 		c.JSON(http.StatusBadRequest, ResponseStatus{message})
-		return
+		return qatFile, Toolchain{}, "", false
 	}
 	if qatFile.ConfirmationKey != os.Getenv("CONFIRMATION_KEY") {
 		message := "Source not confirmed"
 		log.Println(message)
 		c.JSON(http.StatusUnauthorized, ResponseStatus{message})
-		return
+		return qatFile, Toolchain{}, "", false
 	}
-	uniq, err := uuid.NewUUID()
+	files, entryPoint, err := sourceFiles(qatFile)
 	if err != nil {
-		message := "Cannot get UUID directory"
+		message := err.Error()
 		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		return
-	}
-	var dir string
-	if len(os.Args) != 2 {
-		dir = path.Join(os.Getenv("COMPILE_DIR"), uniq.String())
-	} else {
-		dir = path.Join(os.Args[1], os.Getenv("COMPILE_DIR"), uniq.String())
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return qatFile, Toolchain{}, "", false
 	}
-	buildDir := path.Join(dir, "build")
-	mainFile := path.Join(dir, "main.qat")
-	err = os.MkdirAll(buildDir, 0755)
-	if err != nil {
-		message := "Cannot create build directory"
+	if qatFile.KeepArtifacts && !queue.Artifacts().Enabled() {
+		message := "Keeping build artifacts is not enabled on this server"
 		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		os.RemoveAll(dir)
-		return
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return qatFile, Toolchain{}, "", false
 	}
-	err = os.WriteFile(mainFile, []byte(qatFile.Content), 0755)
-	if err != nil {
-		message := "Cannot write contents to file for compile"
+	toolchain, ok := toolchains.Resolve(qatFile.Compiler)
+	if !ok {
+		message := "Compiler version " + qatFile.Compiler + " is not available"
 		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		os.RemoveAll(dir)
-		return
+		c.JSON(http.StatusBadRequest, ResponseStatus{message})
+		return qatFile, Toolchain{}, "", false
 	}
-	var cmd *exec.Cmd
-	if len(os.Args) >= 3 {
-		cmd = exec.Command(path.Join(os.Args[2], "qat"), "build", mainFile, "-o", buildDir, "--no-colors")
-	} else {
-		cmd = exec.Command("qat", "build", mainFile, "-o", buildDir, "--no-colors")
+	return qatFile, toolchain, compileCacheKey(toolchain, files, entryPoint), true
+}
+
+func compileQueueFull(c *gin.Context, queue *CompileQueue) {
+	message := "Compile queue is full, try again later"
+	log.Println(message)
+	c.Header("Retry-After", fmt.Sprint(int(queue.RetryAfter().Seconds())))
+	c.JSON(http.StatusServiceUnavailable, ResponseStatus{message})
+}
+
+func compileHandler(queue *CompileQueue, cache *CompileCache, toolchains *ToolchainRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		qatFile, toolchain, cacheKey, ok := readCompileRequest(c, queue, toolchains)
+		if !ok {
+			return
+		}
+		if cached, ok := cache.Get(cacheKey); ok && canUseCachedResult(qatFile, cached) {
+			cached.Cached = true
+			log.Println("Writing cached result:", *cached)
+			c.JSON(http.StatusOK, cached)
+			return
+		}
+		result, queueInfo, err := queue.Submit(c.Request.Context(), qatFile, toolchain)
+		if errors.Is(err, errCompileQueueFull) {
+			compileQueueFull(c, queue)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
+			return
+		}
+		cache.Put(cacheKey, *result)
+		result.Queue = queueInfo
+		log.Println("Writing final result:", *result)
+		c.JSON(http.StatusOK, result)
 	}
-	err = cmd.Run()
-	if err != nil {
-		message := "Running compiler failed: " + err.Error()
-		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		os.RemoveAll(dir)
-		return
+}
+
+// compileStreamHandler compiles like compileHandler, but reports the progress
+// of the compilation as server-sent events. Phase changes are sent as "phase"
+// events, compiler output as "output" events, and the compile result or the
+// failure end the stream as a "result" or "error" event.
+func compileStreamHandler(queue *CompileQueue, cache *CompileCache, toolchains *ToolchainRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		qatFile, toolchain, cacheKey, ok := readCompileRequest(c, queue, toolchains)
+		if !ok {
+			return
+		}
+		ctx := c.Request.Context()
+		events := make(chan CompileEvent, 64)
+		send := func(event CompileEvent) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		}
+		if cached, ok := cache.Get(cacheKey); ok && canUseCachedResult(qatFile, cached) {
+			cached.Cached = true
+			events <- CompileEvent{Result: cached}
+			close(events)
+		} else {
+			job, err := queue.Enqueue(ctx, qatFile, toolchain, send)
+			if errors.Is(err, errCompileQueueFull) {
+				compileQueueFull(c, queue)
+				return
+			}
+			go func() {
+				defer close(events)
+				result, queueInfo, err := queue.Wait(ctx, job)
+				if err != nil {
+					send(CompileEvent{Message: err.Error()})
+					return
+				}
+				cache.Put(cacheKey, *result)
+				result.Queue = queueInfo
+				send(CompileEvent{Result: result})
+			}()
+		}
+		c.Header("Cache-Control", "no-cache")
+		c.Stream(func(w io.Writer) bool {
+			event, ok := <-events
+			if !ok {
+				return false
+			}
+			switch {
+			case event.Result != nil:
+				c.SSEvent("result", event)
+			case event.Message != "":
+				c.SSEvent("error", event)
+			case event.Phase != "":
+				c.SSEvent("phase", event)
+			default:
+				c.SSEvent("output", event)
+			}
+			return true
+		})
 	}
-	_, err = os.Stat(path.Join(buildDir, "QatCompilationResult.json"))
-	if err != nil {
-		message := "Result file does not exist"
-		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		os.RemoveAll(dir)
-		return
+}
+
+func compilersHandler(toolchains *ToolchainRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		var result struct {
+			Compilers []Toolchain `json:"compilers"`
+		}
+		result.Compilers = toolchains.List()
+		c.JSON(http.StatusOK, result)
 	}
-	resContent, err := os.ReadFile(path.Join(buildDir, "QatCompilationResult.json"))
-	if err != nil {
-		message := "Reading result file failed"
-		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		os.RemoveAll(dir)
-		return
+}
+
+func artifactHandler(artifacts *ArtifactStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		if !artifacts.Enabled() {
+			c.JSON(http.StatusNotFound, ResponseStatus{"Artifacts are not enabled on this server"})
+			return
+		}
+		filePath, err := artifacts.Path(c.Param("id"), c.Param("file"))
+		if err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		c.FileAttachment(filePath, c.Param("file"))
 	}
-	var sysCompRes SystemCompileResult
-	err = json.Unmarshal(resContent, &sysCompRes)
-	if err != nil {
-		message := "Parsing result file failed"
-		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		os.RemoveAll(dir)
-		return
+}
+
+func newSnippetHandler(snippets SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		var newSnippet NewSnippet
+		snipReq, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, int64(envInt("SNIPPET_MAX_KB", 64)*1024*2)))
+		if errors.As(err, new(*http.MaxBytesError)) {
+			message := "Snippet is too large"
+			log.Println(message)
+			c.JSON(http.StatusRequestEntityTooLarge, ResponseStatus{message})
+			return
+		}
+		if err != nil {
+			message := "Error reading request body with error: " + err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		err = json.Unmarshal(snipReq, &newSnippet)
+		if err != nil {
+			message := "Could not decode request body to JSON with error: " + err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		if newSnippet.ConfirmationKey != os.Getenv("CONFIRMATION_KEY") {
+			message := "Source not confirmed"
+			log.Println(message)
+			c.JSON(http.StatusUnauthorized, ResponseStatus{message})
+			return
+		}
+		files, entryPoint, err := sourceFiles(NewCompileFile{
+			Content:    newSnippet.Content,
+			Files:      newSnippet.Files,
+			EntryPoint: newSnippet.EntryPoint,
+		})
+		if err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		size := 0
+		for _, content := range files {
+			size += len(content)
+		}
+		if size > envInt("SNIPPET_MAX_KB", 64)*1024 {
+			message := "Snippet is too large"
+			log.Println(message)
+			c.JSON(http.StatusRequestEntityTooLarge, ResponseStatus{message})
+			return
+		}
+		if newSnippet.ExpiresInHours < 0 {
+			message := "Snippet expiry cannot be negative"
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		var expiresAt *time.Time
+		if newSnippet.ExpiresInHours > 0 {
+			expiry := time.Now().Add(time.Duration(newSnippet.ExpiresInHours) * time.Hour).UTC()
+			expiresAt = &expiry
+		}
+		hash := snippetHash(files, entryPoint, newSnippet.Compiler)
+		existing, err := snippets.FindByHash(c.Request.Context(), hash)
+		if err == nil {
+			if existing.ExpiresAt != nil && expiresAt == nil {
+				err = snippets.SetExpiry(c.Request.Context(), existing.ID, nil)
+			} else if existing.ExpiresAt != nil && expiresAt.After(*existing.ExpiresAt) {
+				err = snippets.SetExpiry(c.Request.Context(), existing.ID, expiresAt)
+			}
+			if err != nil {
+				message := "Could not update the expiry of the existing snippet"
+				log.Println(message)
+				c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+				return
+			}
+			c.JSON(http.StatusOK, SnippetID{existing.ID})
+			return
+		} else if err != ErrNotFound {
+			message := "Error while looking for an existing snippet"
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		snippet := Snippet{
+			Files:      files,
+			EntryPoint: entryPoint,
+			Compiler:   newSnippet.Compiler,
+			Hash:       hash,
+			CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+			ExpiresAt:  expiresAt,
+		}
+		for attempt := 0; attempt < 3; attempt++ {
+			snippet.ID, err = newSnippetID()
+			if err != nil {
+				break
+			}
+			err = snippets.Insert(c.Request.Context(), snippet)
+			if err != ErrDuplicateID {
+				break
+			}
+		}
+		if err != nil {
+			message := "Could not save the snippet"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusCreated, SnippetID{snippet.ID})
 	}
-	if err == nil {
-		log.Println("Writing final result:", sysCompRes)
-		c.JSON(http.StatusOK, sysCompRes)
-		os.RemoveAll(dir)
-		return
-	} else {
-		message := "Converting result failed"
-		log.Println(message)
-		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-		return
+}
+
+func snippetHandler(snippets SnippetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		snippet, err := snippets.Get(c.Request.Context(), c.Param("id"))
+		if err == ErrNotFound {
+			message := "No snippet found with ID"
+			log.Println(message)
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		if err != nil {
+			message := "Error while retrieving the snippet"
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		if len(snippet.Files) == 1 {
+			snippet.Content = snippet.Files[snippet.EntryPoint]
+		}
+		c.JSON(http.StatusOK, snippet)
 	}
 }
 
-func downloadedReleaseHandler(collections *Collections) gin.HandlerFunc {
+func downloadedReleaseHandler(releases ReleaseStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
 		c.Header("Access-Control-Max-Age", "15")
@@ -181,23 +497,20 @@ func downloadedReleaseHandler(collections *Collections) gin.HandlerFunc {
 			c.JSON(http.StatusNotAcceptable, ResponseStatus{message})
 			return
 		}
-		var release LanguageRelease
-		rlsResult := collections.Releases.FindOne(context.Background(), bson.M{"releaseID": releaseDetails.ReleaseID})
-		err = rlsResult.Decode(&release)
+		release, err := releases.Get(c.Request.Context(), releaseDetails.ReleaseID)
+		if err == nil && release.Draft {
+			err = ErrNotFound
+		}
 		if err == nil {
 			var foundPlatform bool
-			var platformIndex int = 0
 			for i := 0; i < len(release.Files); i++ {
 				if release.Files[i].Id == releaseDetails.PlatformID {
 					foundPlatform = true
-					platformIndex = i
 				}
 			}
 			if foundPlatform {
-				updateRes, err := collections.Releases.UpdateOne(context.Background(),
-					bson.M{"releaseID": releaseDetails.ReleaseID},
-					bson.M{"$inc": bson.M{"files." + fmt.Sprint(platformIndex) + ".downloads": 1}})
-				if err != nil || updateRes.ModifiedCount != 1 {
+				err := releases.IncrementDownloads(c.Request.Context(), releaseDetails.ReleaseID, releaseDetails.PlatformID)
+				if err != nil {
 					message := "Could not update release"
 					log.Println(message)
 					c.JSON(http.StatusInternalServerError, ResponseStatus{message})
@@ -223,60 +536,202 @@ func downloadedReleaseHandler(collections *Collections) gin.HandlerFunc {
 	}
 }
 
-func latestCommitHandler(collections *Collections) gin.HandlerFunc {
+func recommendedReleaseHandler(releases ReleaseStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
 		c.Header("Access-Control-Max-Age", "15")
-		var LimitVal int64 = 1
-		cursor, err := collections.Commits.Find(context.Background(), bson.M{}, &options.FindOptions{Limit: &LimitVal, Sort: bson.M{"$natural": -1}})
-		if err == nil {
-			var item NewCommit
-			for cursor.Next(context.Background()) {
-				var itemBson bson.D
-				if err := cursor.Decode(&itemBson); err != nil {
-					message := "Error retrieving the latest commit from the fetched data"
-					log.Println(message)
-					c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-					return
-				} else {
-					itemBytes, err := bson.Marshal(itemBson)
-					if err != nil {
-						message := "Error converting latest commit BSON data to bytes"
-						log.Println(message)
-						c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-						return
-					}
-					err = bson.Unmarshal(itemBytes, &item)
-					if err != nil {
-						message := "Error converting bytes to latest commit data"
-						log.Println(message)
-						c.JSON(http.StatusInternalServerError, ResponseStatus{message})
-						return
-					}
-					break
-				}
-			}
-			c.JSON(http.StatusOK, item)
+		c.Header("Accept-CH", "Sec-CH-UA-Platform, Sec-CH-UA-Arch, Sec-CH-UA-Bitness")
+		c.Header("Vary", "User-Agent, Sec-CH-UA-Platform, Sec-CH-UA-Arch, Sec-CH-UA-Bitness")
+		selection, ok := readReleaseSelection(c, "stable")
+		if !ok {
 			return
-		} else {
-			message := "Error while looking for the latest commit"
+		}
+		selection.query.Platform = ""
+		selection.query.Architecture = ""
+		selected, err := selectReleases(c.Request.Context(), releases, selection)
+		if err != nil {
+			message := "Unable to find releases"
 			log.Println(message)
 			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
 			return
 		}
-	}
-}
-
-func newCommitsHandler(collections *Collections) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
-		c.Header("Access-Control-Max-Age", "15")
-		var newCommitDetails PushedCommits
-		newCommDet, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			message := "Error reading request body with error: " + err.Error()
+		if len(selected) == 0 {
+			message := "No release matches the query"
 			log.Println(message)
-			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		platform, architecture := detectPlatform(c.Request.Header)
+		if c.Query("platform") != "" {
+			platform = normalizePlatform(c.Query("platform"))
+		}
+		if c.Query("architecture") != "" {
+			architecture = normalizeArchitecture(c.Query("architecture"))
+		}
+		latest := selected[0]
+		ranked, fits := rankReleaseFiles(latest.Files, platform, architecture)
+		result := RecommendedDownload{
+			ReleaseID:    latest.ReleaseID,
+			Version:      latest.Version,
+			Platform:     platform,
+			Architecture: architecture,
+			Alternatives: ranked,
+		}
+		if fits {
+			result.Recommended = &ranked[0]
+			result.Alternatives = ranked[1:]
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// redirectToDownload counts a download of the file and redirects to it. A
+// failure to count is logged but does not fail the download.
+func redirectToDownload(c *gin.Context, releases ReleaseStore, releaseID string, file ReleaseFile) {
+	err := releases.IncrementDownloads(c.Request.Context(), releaseID, file.Id)
+	if err != nil {
+		log.Println("Could not count download of "+releaseID+"/"+file.Id+": ", err)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, releaseFileURL(file.Path))
+}
+
+// findPublishedRelease finds the published release with the ID in the path,
+// writing the error response itself when there is none.
+func findPublishedRelease(c *gin.Context, releases ReleaseStore) (*LanguageRelease, bool) {
+	release, err := releases.Get(c.Request.Context(), c.Param("releaseID"))
+	if err == nil && release.Draft {
+		err = ErrNotFound
+	}
+	if err == ErrNotFound {
+		message := "No release found with ID"
+		log.Println(message)
+		c.JSON(http.StatusNotFound, ResponseStatus{message})
+		return nil, false
+	}
+	if err != nil {
+		message := "Unable to find release"
+		log.Println(message, err)
+		c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+		return nil, false
+	}
+	return release, true
+}
+
+func downloadHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		release, ok := findPublishedRelease(c, releases)
+		if !ok {
+			return
+		}
+		for _, file := range release.Files {
+			if file.Id == c.Param("platformID") {
+				redirectToDownload(c, releases, release.ReleaseID, file)
+				return
+			}
+		}
+		message := "Platform not found"
+		log.Println(message)
+		c.JSON(http.StatusNotFound, ResponseStatus{message})
+	}
+}
+
+func sha256SumsHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		release, ok := findPublishedRelease(c, releases)
+		if !ok {
+			return
+		}
+		c.String(http.StatusOK, sha256Sums(*release))
+	}
+}
+
+func releaseSignatureHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		release, ok := findPublishedRelease(c, releases)
+		if !ok {
+			return
+		}
+		for _, file := range release.Files {
+			if file.Id == c.Param("fileID") && file.Signature != "" {
+				c.Header("Content-Disposition", `attachment; filename="`+releaseFileName(file)+`.sig"`)
+				c.String(http.StatusOK, file.Signature+"\n")
+				return
+			}
+		}
+		message := "No signature found for the file"
+		log.Println(message)
+		c.JSON(http.StatusNotFound, ResponseStatus{message})
+	}
+}
+
+func latestDownloadHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		selection, ok := readReleaseSelection(c, "stable")
+		if !ok {
+			return
+		}
+		selection.query.WithoutContent = true
+		selected, err := selectReleases(c.Request.Context(), releases, selection)
+		if err != nil {
+			message := "Unable to find releases"
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		platform := normalizePlatform(c.Param("platform"))
+		architecture := normalizeArchitecture(c.Param("arch"))
+		for _, release := range selected {
+			for _, file := range release.Files {
+				if normalizePlatform(file.Platform) == platform && normalizeArchitecture(file.Architecture) == architecture {
+					redirectToDownload(c, releases, release.ReleaseID, file)
+					return
+				}
+			}
+		}
+		message := "No release found for the platform and architecture"
+		log.Println(message)
+		c.JSON(http.StatusNotFound, ResponseStatus{message})
+	}
+}
+
+func latestCommitHandler(commits CommitStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		item, err := commits.Latest(c.Request.Context())
+		if err == ErrNotFound {
+			c.JSON(http.StatusOK, NewCommit{})
+			return
+		}
+		if err != nil {
+			message := "Error while looking for the latest commit"
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+func newCommitsHandler(commits CommitStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		var newCommitDetails PushedCommits
+		newCommDet, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			message := "Error reading request body with error: " + err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
 			return
 		}
 		err = json.Unmarshal(newCommDet, &newCommitDetails)
@@ -292,20 +747,7 @@ func newCommitsHandler(collections *Collections) gin.HandlerFunc {
 			c.JSON(http.StatusNotAcceptable, ResponseStatus{message})
 			return
 		}
-		var commitVals bson.A
-		for i := 0; i < len(newCommitDetails.Commits); i++ {
-			commitVals = append(commitVals, bson.M{
-				"id":         newCommitDetails.Commits[i].Id,
-				"title":      newCommitDetails.Commits[i].Title,
-				"message":    newCommitDetails.Commits[i].Message,
-				"author":     newCommitDetails.Commits[i].Author,
-				"repository": newCommitDetails.Commits[i].Repository,
-				"site":       newCommitDetails.Commits[i].Site,
-				"timestamp":  newCommitDetails.Commits[i].Timestamp,
-				"ref":        newCommitDetails.Commits[i].Ref,
-			})
-		}
-		_, err = collections.Commits.InsertMany(context.Background(), commitVals)
+		err = commits.Add(c.Request.Context(), newCommitDetails.Commits)
 		if err != nil {
 			message := "Could not add commits to the database"
 			log.Println(message)
@@ -316,11 +758,11 @@ func newCommitsHandler(collections *Collections) gin.HandlerFunc {
 	}
 }
 
-func releaseCountHandler(collections *Collections) gin.HandlerFunc {
+func releaseCountHandler(releases ReleaseStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
 		c.Header("Access-Control-Max-Age", "15")
-		count, err := collections.Releases.CountDocuments(context.Background(), bson.M{})
+		count, err := releases.Count(c.Request.Context())
 		if err == nil {
 			c.JSON(http.StatusOK, CommitCount{Count: count})
 		} else {
@@ -331,95 +773,492 @@ func releaseCountHandler(collections *Collections) gin.HandlerFunc {
 	}
 }
 
-func projectStatsHandler(collections *Collections) gin.HandlerFunc {
+func projectStatsHandler(stats *ProjectStatsService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
 		c.Header("Access-Control-Max-Age", "15")
-		serverConfigRes := collections.Config.FindOne(context.Background(), bson.M{})
-		var config ServerConfig
-		err := serverConfigRes.Decode(&config)
-		if err == nil {
-			wakatimeBaseUrl := "https://wakatime.com/api/v1/users/current/all_time_since_today?project="
-			var allStats AllStatsResult
-			client := http.Client{Timeout: 30 * time.Second}
-			projectHandler := func(projectName string) (*ProjectStats, error) {
-				projectRequest, err := http.NewRequest(http.MethodGet, wakatimeBaseUrl+projectName, nil)
-				if err != nil {
-					message := "could not create request for stats of the compiler project"
-					log.Println(message)
-					return nil, errors.New(message)
-				}
-				projectRequest.Header.Set("Authorization", "Bearer "+config.Wakatime.AccessToken)
-				projectRequest.Header.Set("Access-Control-Origin-Policy", "*")
-				resp, err := client.Do(projectRequest)
-				if err != nil {
-					message := "error making request for stats of the compiler project"
-					log.Println(message)
-					return nil, errors.New(message)
-				}
-				if resp.StatusCode != http.StatusOK {
-					message := "Wakatime request failed with status code: " + fmt.Sprintf("%d", resp.StatusCode)
-					log.Println(message)
-					return nil, errors.New(message)
-				}
-				resBytes, err := io.ReadAll(resp.Body)
-				defer resp.Body.Close()
-				if err != nil {
-					message := "error reading response for stats of the compiler project"
-					log.Println(message)
-					return nil, errors.New(message)
-				}
-				result := new(ProjectStats)
-				err = json.Unmarshal(resBytes, result)
-				if err != nil {
-					message := "error decoding stats of the compiler project to JSON"
-					log.Println(message)
-					log.Println(err.Error())
-					return nil, errors.New(message)
-				}
-				return result, nil
-			}
-			compilerProjectStats, err := projectHandler("qat")
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
-				return
-			}
-			siteProjectStats, err := projectHandler("qatdev")
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
-				return
-			}
-			serverProjectStats, err := projectHandler("QatDevServer")
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
+		allStats := stats.Get(c.Request.Context())
+		for _, project := range allStats {
+			if !project.Unavailable {
+				c.JSON(http.StatusOK, allStats)
 				return
 			}
-			vscodeExtProjectStats, err := projectHandler("qat_vscode")
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
-				return
-			}
-			docsProjectStats, err := projectHandler("QatDocs")
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
-				return
+		}
+		if len(allStats) == 0 {
+			c.JSON(http.StatusOK, allStats)
+			return
+		}
+		log.Println("Stats of all projects are unavailable")
+		c.JSON(http.StatusServiceUnavailable, allStats)
+	}
+}
+
+func projectStatsHistoryHandler(stats *ProjectStatsService, history StatsHistoryStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		ctx := c.Request.Context()
+		interval := c.DefaultQuery("interval", "daily")
+		if !statsHistoryIntervals[interval] {
+			message := "Interval should be daily, weekly or monthly"
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		to := time.Now().UTC().Truncate(24 * time.Hour)
+		var err error
+		if c.Query("to") != "" {
+			to, err = time.Parse(statsDateLayout, c.Query("to"))
+		}
+		from := map[string]time.Time{
+			"daily":   to.AddDate(0, 0, -30),
+			"weekly":  to.AddDate(0, 0, -7*26),
+			"monthly": to.AddDate(-1, 0, 0),
+		}[interval]
+		if err == nil && c.Query("from") != "" {
+			from, err = time.Parse(statsDateLayout, c.Query("from"))
+		}
+		if err != nil || from.After(to) {
+			message := "From and to should be dates in the form YYYY-MM-DD, with from not after to"
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		projects, err := stats.Projects(ctx)
+		if err != nil {
+			message := "Could not retrieve the tracked projects"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		var project *StatsProject
+		for i := range projects {
+			if projects[i].Key == c.Query("project") && projects[i].Visible {
+				project = &projects[i]
 			}
-			tomProjectStats, err := projectHandler("tom")
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ResponseStatus{err.Error()})
-				return
+		}
+		if project == nil {
+			message := "No project found with the key " + c.Query("project")
+			log.Println(message)
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		start := statsPeriodStart(from, interval).Format(statsDateLayout)
+		snapshots, err := history.Range(ctx, project.Name, start, to.Format(statsDateLayout))
+		if err != nil {
+			message := "Error while retrieving the stats history"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		baseline, err := history.LastBefore(ctx, project.Name, start)
+		if err != nil && err != ErrNotFound {
+			message := "Error while retrieving the stats history"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, StatsHistory{
+			Project:  project.Key,
+			Interval: interval,
+			From:     start,
+			To:       to.Format(statsDateLayout),
+			Points:   statsHistoryPoints(snapshots, baseline, interval),
+		})
+	}
+}
+
+func statsProjectsHandler(stats *ProjectStatsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		projects, err := stats.Projects(c.Request.Context())
+		if err != nil {
+			message := "Could not retrieve the tracked projects"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, StatsProjectList{projects})
+	}
+}
+
+func setStatsProjectHandler(stats *ProjectStatsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		var project StatsProject
+		if !readJSONBody(c, &project) {
+			return
+		}
+		project.Key = strings.TrimSpace(project.Key)
+		project.Name = strings.TrimSpace(project.Name)
+		if project.Key == "" || project.Name == "" {
+			message := "Project key and name are required"
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		projects, err := stats.SetProject(c.Request.Context(), project)
+		if err != nil {
+			message := "Could not save the tracked projects"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, StatsProjectList{projects})
+	}
+}
+
+func removeStatsProjectHandler(stats *ProjectStatsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		projects, err := stats.RemoveProject(c.Request.Context(), c.Param("key"))
+		if err == ErrNotFound {
+			message := "No tracked project has the key " + c.Param("key")
+			log.Println(message)
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		if err != nil {
+			message := "Could not save the tracked projects"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, StatsProjectList{projects})
+	}
+}
+
+func wakatimeStatusHandler(tokens *WakatimeTokenManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		c.JSON(http.StatusOK, WakatimeHealth{tokens.Status().ConsecutiveFailures == 0})
+	}
+}
+
+func wakatimeAdminStatusHandler(tokens *WakatimeTokenManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		c.JSON(http.StatusOK, tokens.Status())
+	}
+}
+
+func wakatimeAuthorizeHandler(authorizer *WakatimeAuthorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		authURL, err := authorizer.AuthorizationURL(c.Request.Context())
+		if err != nil {
+			message := "Could not start Wakatime authorization: " + err.Error()
+			log.Println(message)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, AuthorizationURL{authURL})
+	}
+}
+
+func wakatimeCallbackHandler(authorizer *WakatimeAuthorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if errMessage := c.Query("error"); errMessage != "" {
+			message := "Wakatime authorization was denied: " + errMessage
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		err := authorizer.Complete(c.Request.Context(), c.Query("state"), c.Query("code"))
+		if err != nil {
+			message := "Wakatime authorization failed: " + err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, ResponseStatus{"Authorized with Wakatime successfully"})
+	}
+}
+
+// releaseStoreError responds to an error from the release store, and returns
+// whether there was one.
+func releaseStoreError(c *gin.Context, err error, notFound string) bool {
+	if err == nil {
+		return false
+	}
+	if err == ErrNotFound {
+		log.Println(notFound)
+		c.JSON(http.StatusNotFound, ResponseStatus{notFound})
+		return true
+	}
+	message := "Could not update the release"
+	log.Println(message, err)
+	c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+	return true
+}
+
+func adminReleaseListHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		var result struct {
+			Releases []LanguageRelease `json:"releases"`
+		}
+		var err error
+		result.Releases, err = releases.List(c.Request.Context(), ReleaseQuery{IncludeDrafts: true})
+		if err != nil {
+			message := "Unable to find releases"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func createReleaseHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		var newRelease NewRelease
+		if !readJSONBody(c, &newRelease) {
+			return
+		}
+		for i := range newRelease.Files {
+			newRelease.Files[i] = normalizeReleaseFile(newRelease.Files[i])
+		}
+		if err := validateNewRelease(newRelease); err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		files := make([]ReleaseFile, 0, len(newRelease.Files))
+		for _, file := range newRelease.Files {
+			file.Downloads = 0
+			files = append(files, file)
+		}
+		release, err := releases.Create(c.Request.Context(), LanguageRelease{
+			ReleaseID: newRelease.ReleaseID,
+			Version:   newRelease.Version,
+			Title:     newRelease.Title,
+			Content:   newRelease.Content,
+			Files:     files,
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+			Draft:     newRelease.Draft,
+		})
+		if err == ErrDuplicateID {
+			message := "A release with the ID " + newRelease.ReleaseID + " already exists"
+			log.Println(message)
+			c.JSON(http.StatusConflict, ResponseStatus{message})
+			return
+		}
+		if err != nil {
+			message := "Could not create the release"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		c.JSON(http.StatusCreated, release)
+	}
+}
+
+// respondWithRelease responds with the release after it was changed
+func respondWithRelease(c *gin.Context, releases ReleaseStore, releaseID string) {
+	release, err := releases.Get(c.Request.Context(), releaseID)
+	if releaseStoreError(c, err, "No release found with ID") {
+		return
+	}
+	c.JSON(http.StatusOK, release)
+}
+
+func updateReleaseHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		var details ReleaseDetails
+		if !readJSONBody(c, &details) {
+			return
+		}
+		if err := validateReleaseVersion(details.Version); err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		err := releases.Update(c.Request.Context(), c.Param("releaseID"), details)
+		if releaseStoreError(c, err, "No release found with ID") {
+			return
+		}
+		respondWithRelease(c, releases, c.Param("releaseID"))
+	}
+}
+
+func publishReleaseHandler(releases ReleaseStore, publish bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		err := releases.SetDraft(c.Request.Context(), c.Param("releaseID"), !publish)
+		if releaseStoreError(c, err, "No release found with ID") {
+			return
+		}
+		respondWithRelease(c, releases, c.Param("releaseID"))
+	}
+}
+
+func deleteReleaseHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		err := releases.Delete(c.Request.Context(), c.Param("releaseID"))
+		if releaseStoreError(c, err, "No release found with ID") {
+			return
+		}
+		c.JSON(http.StatusOK, ResponseStatus{"Deleted release successfully"})
+	}
+}
+
+func setReleaseFileHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		var file ReleaseFile
+		if !readJSONBody(c, &file) {
+			return
+		}
+		file.Id = c.Param("fileID")
+		file = normalizeReleaseFile(file)
+		if err := validateReleaseFile(file); err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		err := releases.SetFile(c.Request.Context(), c.Param("releaseID"), file)
+		if releaseStoreError(c, err, "No release found with ID") {
+			return
+		}
+		respondWithRelease(c, releases, c.Param("releaseID"))
+	}
+}
+
+// uploadReleaseFileHandler stores the request body as the artifact of a release
+// file and links it into the file, along with its size and checksum. The file
+// is created if needed, taking its platform, architecture and target from the
+// query.
+func uploadReleaseFileHandler(releases ReleaseStore, blobs BlobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		ctx := c.Request.Context()
+		release, err := releases.Get(ctx, c.Param("releaseID"))
+		if releaseStoreError(c, err, "No release found with ID") {
+			return
+		}
+		file := ReleaseFile{
+			Id:           c.Param("fileID"),
+			Platform:     c.Query("platform"),
+			Architecture: c.Query("architecture"),
+			Target:       c.Query("target"),
+		}
+		for _, existing := range release.Files {
+			if existing.Id == file.Id {
+				file = existing
 			}
-			allStats.Compiler = *compilerProjectStats
-			allStats.Website = *siteProjectStats
-			allStats.Server = *serverProjectStats
-			allStats.VSCode = *vscodeExtProjectStats
-			allStats.Docs = *docsProjectStats
-			allStats.Tom = *tomProjectStats
-			c.JSON(http.StatusOK, allStats)
-		} else {
-			message := "Could not decode server config"
+		}
+		name := c.DefaultQuery("name", file.Id)
+		if !releaseFileIDPattern.MatchString(name) {
+			message := "File name should only contain letters, digits, dots, dashes and underscores"
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		key := "releases/" + release.ReleaseID + "/" + name
+		file.Path = "/storage/" + key
+		if err := validateReleaseFile(file); err != nil {
+			message := err.Error()
+			log.Println(message)
+			c.JSON(http.StatusBadRequest, ResponseStatus{message})
+			return
+		}
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, int64(envInt("RELEASE_UPLOAD_MAX_MB", 1024))<<20)
+		info, err := blobs.Put(ctx, key, body)
+		if errors.As(err, new(*http.MaxBytesError)) {
+			message := "Uploaded file is too large"
+			log.Println(message)
+			c.JSON(http.StatusRequestEntityTooLarge, ResponseStatus{message})
+			return
+		}
+		if err != nil {
+			message := "Could not store the uploaded file"
+			log.Println(message, err)
+			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		// The signature of the previous upload does not sign the new content
+		if info.SHA256 != file.SHA256 {
+			file.Signature = ""
+		}
+		file.SHA256 = info.SHA256
+		file.Size = info.Size
+		err = releases.SetFile(ctx, release.ReleaseID, file)
+		if releaseStoreError(c, err, "No release found with ID") {
+			return
+		}
+		respondWithRelease(c, releases, release.ReleaseID)
+	}
+}
+
+func blobHandler(blobs BlobStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		blob, err := blobs.Open(c.Request.Context(), key)
+		if err == ErrNotFound {
+			message := "No file found at " + key
 			log.Println(message)
+			c.JSON(http.StatusNotFound, ResponseStatus{message})
+			return
+		}
+		if err != nil {
+			message := "Error while opening the file"
+			log.Println(message, err)
 			c.JSON(http.StatusInternalServerError, ResponseStatus{message})
+			return
+		}
+		defer blob.Close()
+		info := blob.Info()
+		if info.ETag != "" {
+			c.Header("ETag", info.ETag)
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+path.Base(key)+`"`)
+		http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, blob)
+	}
+}
+
+func removeReleaseFileHandler(releases ReleaseStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !adminAuthorized(c) {
+			return
+		}
+		err := releases.RemoveFile(c.Request.Context(), c.Param("releaseID"), c.Param("fileID"))
+		if releaseStoreError(c, err, "No release or file found with ID") {
+			return
 		}
+		respondWithRelease(c, releases, c.Param("releaseID"))
 	}
 }
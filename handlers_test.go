@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(stores *Stores) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/releases", releaseListHandler(stores.Releases))
+	r.GET("/releases/latest", latestReleaseHandler(stores.Releases))
+	r.GET("/releaseCount", releaseCountHandler(stores.Releases))
+	r.POST("/downloadedRelease", downloadedReleaseHandler(stores.Releases))
+	r.GET("/download/:releaseID/:platformID", downloadHandler(stores.Releases))
+	r.GET("/download/latest/:platform/:arch", latestDownloadHandler(stores.Releases))
+	r.POST("/newCommits", newCommitsHandler(stores.Commits))
+	r.GET("/latestCommit", latestCommitHandler(stores.Commits))
+	r.POST("/admin/releases", createReleaseHandler(stores.Releases))
+	r.POST("/admin/releases/:releaseID/publish", publishReleaseHandler(stores.Releases, true))
+	return r
+}
+
+func serve(r *gin.Engine, method string, target string, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, value interface{}) {
+	t.Helper()
+	err := json.Unmarshal(w.Body.Bytes(), value)
+	if err != nil {
+		t.Fatalf("could not decode %q: %s", w.Body.String(), err)
+	}
+}
+
+func testRelease(releaseID string, version string, prerelease string) LanguageRelease {
+	return LanguageRelease{
+		ReleaseID: releaseID,
+		Version:   ReleaseVersion{Value: version, IsPrerelease: prerelease != "", Prerelease: prerelease},
+		Title:     "qat " + version,
+		Content:   "Notes of " + version,
+		CreatedAt: "2026-01-01T00:00:00Z",
+		Files: []ReleaseFile{
+			{Id: "linux-x64", Platform: "linux", Architecture: "x64", Path: "/files/" + releaseID + "/qat-linux-x64.tar.gz"},
+			{Id: "windows-x64", Platform: "windows", Architecture: "x64", Path: "/files/" + releaseID + "/qat-windows-x64.zip"},
+		},
+	}
+}
+
+func newTestStores() *Stores {
+	stores := NewMemoryStores()
+	releases := stores.Releases.(*MemoryReleaseStore)
+	releases.Add(testRelease("v0.1.0", "0.1.0", ""))
+	releases.Add(testRelease("v0.3.0-beta", "0.3.0", "beta"))
+	releases.Add(testRelease("v0.2.0", "0.2.0", ""))
+	draft := testRelease("v0.4.0", "0.4.0", "")
+	draft.Draft = true
+	releases.Add(draft)
+	return stores
+}
+
+func releaseIDs(releases []LanguageRelease) string {
+	ids := make([]string, 0, len(releases))
+	for _, release := range releases {
+		ids = append(ids, release.ReleaseID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestReleaseList(t *testing.T) {
+	r := newTestRouter(newTestStores())
+	var page struct {
+		Releases   []LanguageRelease `json:"releases"`
+		Pagination ReleasePage       `json:"pagination"`
+	}
+	w := serve(r, "GET", "/releases", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	decodeBody(t, w, &page)
+	if ids := releaseIDs(page.Releases); ids != "v0.3.0-beta,v0.2.0,v0.1.0" {
+		t.Errorf("expected published releases by version, got %s", ids)
+	}
+	if page.Releases[0].Content != "Notes of 0.3.0" {
+		t.Errorf("expected release content, got %q", page.Releases[0].Content)
+	}
+
+	w = serve(r, "GET", "/releases?channel=stable&limit=1&content=false", "", nil)
+	page.Releases = nil
+	decodeBody(t, w, &page)
+	if ids := releaseIDs(page.Releases); ids != "v0.2.0" || page.Pagination.Total != 2 || page.Pagination.NextCursor == "" {
+		t.Fatalf("unexpected first page %s %+v", ids, page.Pagination)
+	}
+	if page.Releases[0].Content != "" {
+		t.Errorf("expected no content, got %q", page.Releases[0].Content)
+	}
+	w = serve(r, "GET", "/releases?channel=stable&limit=1&cursor="+page.Pagination.NextCursor, "", nil)
+	page.Releases, page.Pagination = nil, ReleasePage{}
+	decodeBody(t, w, &page)
+	if ids := releaseIDs(page.Releases); ids != "v0.1.0" || page.Pagination.NextCursor != "" {
+		t.Errorf("unexpected second page %s %+v", ids, page.Pagination)
+	}
+
+	if w := serve(r, "GET", "/releases?limit=0", "", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit, got %d", w.Code)
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	r := newTestRouter(newTestStores())
+	var latest LanguageRelease
+	decodeBody(t, serve(r, "GET", "/releases/latest", "", nil), &latest)
+	if latest.ReleaseID != "v0.2.0" {
+		t.Errorf("expected the latest stable release, got %s", latest.ReleaseID)
+	}
+	decodeBody(t, serve(r, "GET", "/releases/latest?channel=prerelease", "", nil), &latest)
+	if latest.ReleaseID != "v0.3.0-beta" {
+		t.Errorf("expected the latest prerelease, got %s", latest.ReleaseID)
+	}
+}
+
+func TestCreateAndPublishRelease(t *testing.T) {
+	t.Setenv("ADMIN_KEY", "admin")
+	r := newTestRouter(newTestStores())
+	admin := map[string]string{"Authorization": "Bearer admin"}
+	body := `{"releaseID": "v1.0.0", "version": {"value": "1.0.0"}, "draft": true,
+		"files": [{"id": "linux-x64", "platform": "linux", "architecture": "x64", "path": "/files/qat.tar.gz"}]}`
+	if w := serve(r, "POST", "/admin/releases", body, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin key, got %d", w.Code)
+	}
+	if w := serve(r, "POST", "/admin/releases", body, admin); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, "POST", "/admin/releases", body, admin); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate release, got %d", w.Code)
+	}
+	var count struct {
+		Count int64 `json:"count"`
+	}
+	decodeBody(t, serve(r, "GET", "/releaseCount", "", nil), &count)
+	if count.Count != 3 {
+		t.Errorf("expected drafts not to be counted, got %d", count.Count)
+	}
+	if w := serve(r, "POST", "/admin/releases/v1.0.0/publish", "", admin); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	decodeBody(t, serve(r, "GET", "/releaseCount", "", nil), &count)
+	if count.Count != 4 {
+		t.Errorf("expected the published release to be counted, got %d", count.Count)
+	}
+	var latest LanguageRelease
+	decodeBody(t, serve(r, "GET", "/releases/latest", "", nil), &latest)
+	if latest.ReleaseID != "v1.0.0" {
+		t.Errorf("expected the published release to be the latest, got %s", latest.ReleaseID)
+	}
+}
+
+func TestCommits(t *testing.T) {
+	t.Setenv("CONFIRMATION_KEY", "secret")
+	r := newTestRouter(NewMemoryStores())
+	var latest NewCommit
+	decodeBody(t, serve(r, "GET", "/latestCommit", "", nil), &latest)
+	if latest.Id != "" {
+		t.Errorf("expected no commit, got %+v", latest)
+	}
+	body := `{"confirmationKey": "%s", "commits": [{"id": "a1", "title": "First"}, {"id": "b2", "title": "Second"}]}`
+	if w := serve(r, "POST", "/newCommits", strings.Replace(body, "%s", "wrong", 1), nil); w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected 406 for a wrong key, got %d", w.Code)
+	}
+	if w := serve(r, "POST", "/newCommits", strings.Replace(body, "%s", "secret", 1), nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	decodeBody(t, serve(r, "GET", "/latestCommit", "", nil), &latest)
+	if latest.Id != "b2" {
+		t.Errorf("expected the last pushed commit, got %+v", latest)
+	}
+}
+
+func fileDownloads(t *testing.T, releases ReleaseStore, releaseID string, fileID string) int {
+	t.Helper()
+	release, err := releases.Get(context.Background(), releaseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range release.Files {
+		if file.Id == fileID {
+			return file.Downloads
+		}
+	}
+	t.Fatalf("release %s has no file %s", releaseID, fileID)
+	return 0
+}
+
+func TestDownloadCounting(t *testing.T) {
+	t.Setenv("CONFIRMATION_KEY", "secret")
+	t.Setenv("DOWNLOAD_BASE_URL", "https://downloads.example")
+	stores := newTestStores()
+	r := newTestRouter(stores)
+
+	w := serve(r, "GET", "/download/v0.2.0/linux-x64", "", nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://downloads.example/files/v0.2.0/qat-linux-x64.tar.gz" {
+		t.Fatalf("unexpected redirect %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	w = serve(r, "GET", "/download/latest/Linux/amd64", "", nil)
+	if w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Location"), "/v0.2.0/qat-linux-x64") {
+		t.Fatalf("unexpected redirect %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	body := `{"confirmationKey": "secret", "releaseID": "v0.2.0", "platformID": "linux-x64"}`
+	if w := serve(r, "POST", "/downloadedRelease", body, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if downloads := fileDownloads(t, stores.Releases, "v0.2.0", "linux-x64"); downloads != 3 {
+		t.Errorf("expected 3 downloads, got %d", downloads)
+	}
+	if downloads := fileDownloads(t, stores.Releases, "v0.2.0", "windows-x64"); downloads != 0 {
+		t.Errorf("expected no downloads of the other file, got %d", downloads)
+	}
+
+	for _, target := range []string{"/download/v0.2.0/macos-arm64", "/download/v0.4.0/linux-x64", "/download/v9/linux-x64"} {
+		if w := serve(r, "GET", target, "", nil); w.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for %s, got %d", target, w.Code)
+		}
+	}
+	if downloads := fileDownloads(t, stores.Releases, "v0.4.0", "linux-x64"); downloads != 0 {
+		t.Errorf("expected downloads of drafts not to be counted, got %d", downloads)
+	}
+}
+
+func TestUploadReleaseFile(t *testing.T) {
+	t.Setenv("ADMIN_KEY", "admin")
+	t.Setenv("RELEASE_UPLOAD_MAX_MB", "1")
+	stores := newTestStores()
+	r := newTestRouter(stores)
+	r.POST("/admin/releases/:releaseID/files/:fileID/upload", uploadReleaseFileHandler(stores.Releases, &LocalBlobStore{dir: t.TempDir()}))
+	admin := map[string]string{"Authorization": "Bearer admin"}
+	release, err := stores.Releases.Get(context.Background(), "v0.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := release.Files[0]
+	signed.Signature = "signature of the old content"
+	if err := stores.Releases.SetFile(context.Background(), "v0.2.0", signed); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(r, "POST", "/admin/releases/v0.2.0/files/linux-x64/upload", "new content", admin); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	release, err = stores.Releases.Get(context.Background(), "v0.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file := release.Files[0]; file.Signature != "" || file.Size != int64(len("new content")) {
+		t.Errorf("expected the new content without the old signature, got %+v", file)
+	}
+
+	w := serve(r, "POST", "/admin/releases/v0.2.0/files/linux-x64/upload", strings.Repeat("a", 1<<20+1), admin)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized upload, got %d", w.Code)
+	}
+}
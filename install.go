@@ -0,0 +1,253 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+)
+
+type installFile struct {
+	Platform     string
+	Architecture string
+	Name         string
+	URL          string
+	SHA256       string
+}
+
+type installScriptData struct {
+	Version string
+	Files   []installFile
+}
+
+// shellQuote quotes the value for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// powerShellQuote quotes the value for PowerShell
+func powerShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+var installTemplateFuncs = template.FuncMap{"sh": shellQuote, "ps": powerShellQuote}
+
+var installShTemplate = template.Must(template.New("install.sh").Funcs(installTemplateFuncs).Parse(`#!/bin/sh
+# Installs qat {{.Version}}, the latest release of the qat programming language.
+#   curl -fsSL https://qat.dev/install.sh | sh
+# Set QAT_INSTALL_DIR to change where it is installed, ~/.qat by default.
+set -eu
+
+version={{sh .Version}}
+install_dir="${QAT_INSTALL_DIR:-$HOME/.qat}"
+
+case "$(uname -s)" in
+	Linux) platform=linux ;;
+	Darwin) platform=macos ;;
+	FreeBSD) platform=freebsd ;;
+	*) echo "qat is not available for $(uname -s)" >&2; exit 1 ;;
+esac
+case "$(uname -m)" in
+	x86_64 | amd64) arch=x64 ;;
+	aarch64 | arm64) arch=arm64 ;;
+	i386 | i686) arch=x86 ;;
+	armv7*) arch=arm ;;
+	*) arch="$(uname -m)" ;;
+esac
+
+case "$platform/$arch" in
+{{- range .Files}}
+	{{sh .Platform}}/{{sh .Architecture}})
+		url={{sh .URL}}
+		name={{sh .Name}}
+		sha256={{sh .SHA256}}
+		;;
+{{- end}}
+	*) echo "qat $version is not available for $platform/$arch" >&2; exit 1 ;;
+esac
+
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT
+echo "Downloading qat $version for $platform/$arch"
+if command -v curl > /dev/null; then
+	curl -fsSL "$url" -o "$tmp/$name"
+elif command -v wget > /dev/null; then
+	wget -qO "$tmp/$name" "$url"
+else
+	echo "curl or wget is required to download qat" >&2
+	exit 1
+fi
+
+if [ -z "$sha256" ]; then
+	echo "No checksum is published for this download" >&2
+	exit 1
+fi
+if command -v sha256sum > /dev/null; then
+	actual="$(sha256sum "$tmp/$name" | cut -d ' ' -f 1)"
+else
+	actual="$(shasum -a 256 "$tmp/$name" | cut -d ' ' -f 1)"
+fi
+if [ "$actual" != "$sha256" ]; then
+	echo "Checksum mismatch for $name, expected $sha256 but got $actual" >&2
+	exit 1
+fi
+
+mkdir -p "$install_dir/bin"
+case "$name" in
+	*.tar.gz | *.tgz) tar -xzf "$tmp/$name" -C "$install_dir" ;;
+	*.tar.xz) tar -xJf "$tmp/$name" -C "$install_dir" ;;
+	*.zip) unzip -oq "$tmp/$name" -d "$install_dir" ;;
+	*) cp "$tmp/$name" "$install_dir/bin/qat" && chmod +x "$install_dir/bin/qat" ;;
+esac
+
+echo "Installed qat $version to $install_dir"
+case ":$PATH:" in
+	*":$install_dir/bin:"*) ;;
+	*) echo "Add $install_dir/bin to your PATH to use qat" ;;
+esac
+`))
+
+var installPs1Template = template.Must(template.New("install.ps1").Funcs(installTemplateFuncs).Parse(`# Installs qat {{.Version}}, the latest release of the qat programming language.
+#   irm https://qat.dev/install.ps1 | iex
+# Set QAT_INSTALL_DIR to change where it is installed, ~\.qat by default.
+$ErrorActionPreference = 'Stop'
+
+$version = {{ps .Version}}
+$installDir = if ($env:QAT_INSTALL_DIR) { $env:QAT_INSTALL_DIR } else { Join-Path $HOME '.qat' }
+$arch = switch ($env:PROCESSOR_ARCHITECTURE) {
+	'AMD64' { 'x64' }
+	'ARM64' { 'arm64' }
+	'x86' { 'x86' }
+	default { $env:PROCESSOR_ARCHITECTURE }
+}
+
+$files = @{
+{{- range .Files}}
+	{{ps .Architecture}} = @{ Url = {{ps .URL}}; Name = {{ps .Name}}; Sha256 = {{ps .SHA256}} }
+{{- end}}
+}
+$file = $files[$arch]
+if (-not $file) {
+	throw "qat $version is not available for windows/$arch"
+}
+
+$tmp = Join-Path ([System.IO.Path]::GetTempPath()) ([System.Guid]::NewGuid())
+New-Item -ItemType Directory -Path $tmp | Out-Null
+try {
+	Write-Host "Downloading qat $version for windows/$arch"
+	$download = Join-Path $tmp $file.Name
+	Invoke-WebRequest -Uri $file.Url -OutFile $download -UseBasicParsing
+	if (-not $file.Sha256) {
+		throw 'No checksum is published for this download'
+	}
+	$actual = (Get-FileHash -Path $download -Algorithm SHA256).Hash.ToLower()
+	if ($actual -ne $file.Sha256) {
+		throw "Checksum mismatch for $($file.Name), expected $($file.Sha256) but got $actual"
+	}
+	$binDir = Join-Path $installDir 'bin'
+	New-Item -ItemType Directory -Force -Path $binDir | Out-Null
+	if ($file.Name.EndsWith('.zip')) {
+		Expand-Archive -Path $download -DestinationPath $installDir -Force
+	} else {
+		Copy-Item -Path $download -Destination (Join-Path $binDir 'qat.exe') -Force
+	}
+} finally {
+	Remove-Item -Recurse -Force $tmp
+}
+
+$userPath = [Environment]::GetEnvironmentVariable('Path', 'User')
+if (-not ($userPath -split ';' -contains $binDir)) {
+	[Environment]::SetEnvironmentVariable('Path', "$userPath;$binDir", 'User')
+	Write-Host "Added $binDir to your PATH, restart your terminal to use qat"
+}
+Write-Host "Installed qat $version to $installDir"
+`))
+
+// installScriptHandler serves the install script generated from the latest
+// stable release, for PowerShell on Windows when powerShell is set
+func installScriptHandler(releases ReleaseStore, powerShell bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOWED_ORIGIN"))
+		c.Header("Access-Control-Max-Age", "15")
+		c.Header("Cache-Control", "no-cache")
+		fail := func(status int, message string) {
+			log.Println(message)
+			if powerShell {
+				c.String(status, "throw %s\n", powerShellQuote(message))
+			} else {
+				c.String(status, "echo %s >&2\nexit 1\n", shellQuote(message))
+			}
+		}
+		// The script is piped into a shell, so its URLs never come from the request
+		baseURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+		if baseURL == "" {
+			fail(http.StatusInternalServerError, "PUBLIC_URL has to be configured to serve install scripts")
+			return
+		}
+		selected, err := selectReleases(c.Request.Context(), releases,
+			releaseSelection{channel: "stable", query: ReleaseQuery{WithoutContent: true}})
+		if err != nil {
+			fail(http.StatusInternalServerError, "Unable to find releases")
+			return
+		}
+		if len(selected) == 0 {
+			fail(http.StatusNotFound, "No release of qat is available yet")
+			return
+		}
+		script, platform := installShTemplate, "unix"
+		if powerShell {
+			script, platform = installPs1Template, "windows"
+		}
+		var rendered strings.Builder
+		err = script.Execute(&rendered, newInstallScriptData(selected[0], baseURL, platform))
+		if err != nil {
+			log.Println(err)
+			fail(http.StatusInternalServerError, "Could not generate the install script")
+			return
+		}
+		c.String(http.StatusOK, rendered.String())
+	}
+}
+
+// requestBaseURL is the URL the server is reached at, from PUBLIC_URL or else
+// the request itself. X-Forwarded-Proto is only trusted with TRUST_PROXY set,
+// when the server is behind a proxy that overwrites it.
+func requestBaseURL(c *gin.Context) string {
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || (os.Getenv("TRUST_PROXY") != "" && c.GetHeader("X-Forwarded-Proto") == "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// newInstallScriptData lists one file of the release per platform and
+// architecture, downloaded through the counting download endpoint
+func newInstallScriptData(release LanguageRelease, baseURL string, platform string) installScriptData {
+	data := installScriptData{Version: release.Version.Value}
+	if version, err := releaseSemVer(release.Version); err == nil {
+		data.Version = version.String()
+	}
+	seen := make(map[string]bool)
+	for _, file := range release.Files {
+		filePlatform := normalizePlatform(file.Platform)
+		architecture := normalizeArchitecture(file.Architecture)
+		if (platform == "windows") != (filePlatform == "windows") || seen[filePlatform+"/"+architecture] {
+			continue
+		}
+		seen[filePlatform+"/"+architecture] = true
+		data.Files = append(data.Files, installFile{
+			Platform:     filePlatform,
+			Architecture: architecture,
+			Name:         releaseFileName(file),
+			URL:          baseURL + "/download/" + release.ReleaseID + "/" + file.Id,
+			SHA256:       file.SHA256,
+		})
+	}
+	return data
+}
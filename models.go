@@ -1,12 +1,19 @@
 package main
 
-import "go.mongodb.org/mongo-driver/mongo"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
 type Collections struct {
-	Updates  *mongo.Collection
-	Releases *mongo.Collection
-	Commits  *mongo.Collection
-	Config   *mongo.Collection
+	Updates      *mongo.Collection
+	Releases     *mongo.Collection
+	Commits      *mongo.Collection
+	Config       *mongo.Collection
+	CompileCache *mongo.Collection
+	Snippets     *mongo.Collection
+	StatsHistory *mongo.Collection
 }
 
 type WakatimeConfig struct {
@@ -18,42 +25,157 @@ type WakatimeConfig struct {
 	RefreshURL   string `json:"refreshURL" bson:"refreshURL"`
 }
 
+type WakatimeTokens struct {
+	AccessToken  string `json:"accessToken" bson:"accessToken"`
+	RefreshToken string `json:"refreshToken" bson:"refreshToken"`
+	ExpiresAt    string `json:"expiresAt" bson:"expiresAt"`
+}
+
+type WakatimeRefreshStatus struct {
+	ExpiresAt           string `json:"expiresAt,omitempty"`
+	LastAttempt         string `json:"lastAttempt,omitempty"`
+	LastSuccess         string `json:"lastSuccess,omitempty"`
+	LastError           string `json:"lastError,omitempty"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	NextCheck           string `json:"nextCheck,omitempty"`
+}
+
+type WakatimeHealth struct {
+	Healthy bool `json:"healthy"`
+}
+
+type AuthorizationURL struct {
+	URL string `json:"url"`
+}
+
+type StatsProject struct {
+	Key     string `json:"key" bson:"key"`
+	Name    string `json:"name" bson:"name"`
+	Visible bool   `json:"visible" bson:"visible"`
+}
+
+type StatsProjectList struct {
+	Projects []StatsProject `json:"projects"`
+}
+
 type ServerConfig struct {
 	Wakatime WakatimeConfig `json:"wakatime" bson:"wakatime"`
+	Projects []StatsProject `json:"projects" bson:"projects,omitempty"`
+}
+
+type ReleaseVersion struct {
+	Value        string `json:"value" bson:"value"`
+	IsPrerelease bool   `json:"isPrerelease" bson:"isPrerelease"`
+	Prerelease   string `json:"prerelease" bson:"prerelease"`
+}
+
+type ReleaseFile struct {
+	Id           string `json:"id" bson:"id"`
+	Platform     string `json:"platform" bson:"platform"`
+	Target       string `json:"target" bson:"target"`
+	Architecture string `json:"architecture" bson:"architecture"`
+	Downloads    int    `json:"downloads" bson:"downloads"`
+	Path         string `json:"path" bson:"path"`
+	SHA256       string `json:"sha256,omitempty" bson:"sha256,omitempty"`
+	Size         int64  `json:"size,omitempty" bson:"size,omitempty"`
+	Signature    string `json:"signature,omitempty" bson:"signature,omitempty"`
 }
 
 type LanguageRelease struct {
-	ReleaseID string `json:"releaseID"`
-	Version   struct {
-		Value        string `json:"value"`
-		IsPrerelease bool   `json:"isPrerelease"`
-		Prerelease   string `json:"prerelease"`
-	} `json:"version"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Files   []struct {
-		Id           string `json:"id"`
-		Platform     string `json:"platform"`
-		Target       string `json:"target"`
-		Architecture string `json:"architecture"`
-		Downloads    int    `json:"downloads"`
-		Path         string `json:"path"`
-	} `json:"files"`
-	Index     int    `json:"index"`
-	CreatedAt string `json:"createdAt"`
+	ReleaseID string         `json:"releaseID" bson:"releaseID"`
+	Version   ReleaseVersion `json:"version" bson:"version"`
+	Title     string         `json:"title" bson:"title"`
+	Content   string         `json:"content,omitempty" bson:"content"`
+	Files     []ReleaseFile  `json:"files" bson:"files"`
+	Index     int            `json:"index" bson:"index"`
+	CreatedAt string         `json:"createdAt" bson:"createdAt"`
+	UpdatedAt string         `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	Draft     bool           `json:"draft,omitempty" bson:"draft,omitempty"`
+}
+
+// ReleaseQuery filters releases. The file filters match releases having a
+// file with all of the given platform, architecture and target.
+type ReleaseQuery struct {
+	IncludeDrafts  bool
+	ReleaseIDs     []string
+	Platform       string
+	Architecture   string
+	Target         string
+	WithoutContent bool
+}
+
+type ReleasePage struct {
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// RecommendedDownload is the file of a release fitting the detected platform
+// and architecture, if any, along with the other files of the release
+type RecommendedDownload struct {
+	ReleaseID    string         `json:"releaseID"`
+	Version      ReleaseVersion `json:"version"`
+	Platform     string         `json:"platform"`
+	Architecture string         `json:"architecture"`
+	Recommended  *ReleaseFile   `json:"recommended"`
+	Alternatives []ReleaseFile  `json:"alternatives"`
+}
+
+type NewRelease struct {
+	ReleaseID string         `json:"releaseID"`
+	Version   ReleaseVersion `json:"version"`
+	Title     string         `json:"title"`
+	Content   string         `json:"content"`
+	Files     []ReleaseFile  `json:"files"`
+	Draft     bool           `json:"draft"`
+}
+
+type ReleaseDetails struct {
+	Version ReleaseVersion `json:"version"`
+	Title   string         `json:"title"`
+	Content string         `json:"content"`
 }
 
 type LanguageUpdate struct {
-	Content   string `json:"content"`
-	Title     string `json:"title"`
-	CreatedAt string `json:"createdAt"`
-	Index     int    `json:"index"`
+	Content   string `json:"content" bson:"content"`
+	Title     string `json:"title" bson:"title"`
+	CreatedAt string `json:"createdAt" bson:"createdAt"`
+	Index     int    `json:"index" bson:"index"`
 }
 
 type NewCompileFile struct {
-	ConfirmationKey string `json:"confirmationKey"`
-	Content         string `json:"content"`
-	Time            string `json:"time"`
+	ConfirmationKey string            `json:"confirmationKey"`
+	Content         string            `json:"content"`
+	Files           map[string]string `json:"files,omitempty"`
+	EntryPoint      string            `json:"entryPoint,omitempty"`
+	Compiler        string            `json:"compiler,omitempty"`
+	Time            string            `json:"time"`
+	Run             bool              `json:"run"`
+	KeepArtifacts   bool              `json:"keepArtifacts"`
+}
+
+type NewSnippet struct {
+	ConfirmationKey string            `json:"confirmationKey"`
+	Content         string            `json:"content"`
+	Files           map[string]string `json:"files,omitempty"`
+	EntryPoint      string            `json:"entryPoint,omitempty"`
+	Compiler        string            `json:"compiler,omitempty"`
+	ExpiresInHours  int               `json:"expiresInHours,omitempty"`
+}
+
+type Snippet struct {
+	ID         string            `json:"id" bson:"id"`
+	Content    string            `json:"content,omitempty" bson:"-"`
+	Files      map[string]string `json:"files" bson:"files"`
+	EntryPoint string            `json:"entryPoint" bson:"entryPoint"`
+	Compiler   string            `json:"compiler,omitempty" bson:"compiler,omitempty"`
+	Hash       string            `json:"-" bson:"hash"`
+	CreatedAt  string            `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  *time.Time        `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+}
+
+type SnippetID struct {
+	ID string `json:"id"`
 }
 
 type FilePos struct {
@@ -104,12 +226,65 @@ type CommitCount struct {
 }
 
 type SystemCompileResult struct {
-	Problems        []Problem `json:"problems"`
-	Status          bool      `json:"status"`
-	CompilationTime int64     `json:"compilationTime"`
-	LinkingTime     int64     `json:"linkingTime"`
-	BinarySizes     []int64   `json:"binarySizes"`
-	HasMain         bool      `json:"hasMain"`
+	Problems        []Problem     `json:"problems"`
+	Status          bool          `json:"status"`
+	CompilationTime int64         `json:"compilationTime"`
+	LinkingTime     int64         `json:"linkingTime"`
+	BinarySizes     []int64       `json:"binarySizes"`
+	HasMain         bool          `json:"hasMain"`
+	TimedOut        bool          `json:"timedOut"`
+	Cached          bool          `json:"cached"`
+	Compiler        string        `json:"compiler,omitempty"`
+	Run             *RunResult    `json:"run,omitempty"`
+	Queue           *QueueInfo    `json:"queue,omitempty"`
+	Artifacts       *ArtifactInfo `json:"artifacts,omitempty"`
+}
+
+type ArtifactInfo struct {
+	ID        string   `json:"id"`
+	Files     []string `json:"files"`
+	ExpiresAt string   `json:"expiresAt"`
+}
+
+type Toolchain struct {
+	ReleaseID    string `json:"releaseID"`
+	Version      string `json:"version"`
+	IsPrerelease bool   `json:"isPrerelease"`
+	Prerelease   string `json:"prerelease,omitempty"`
+	IsDefault    bool   `json:"isDefault"`
+	Binary       string `json:"-"`
+}
+
+const (
+	CompilePhaseQueued    = "queued"
+	CompilePhaseCompiling = "compiling"
+	CompilePhaseLinking   = "linking"
+	CompilePhaseRunning   = "running"
+)
+
+type CompileEvent struct {
+	Phase    string               `json:"phase,omitempty"`
+	Position int                  `json:"position,omitempty"`
+	Stream   string               `json:"stream,omitempty"`
+	Line     string               `json:"line,omitempty"`
+	Result   *SystemCompileResult `json:"result,omitempty"`
+	Message  string               `json:"message,omitempty"`
+}
+
+type QueueInfo struct {
+	Position int   `json:"position"`
+	WaitTime int64 `json:"waitTime"`
+}
+
+type RunResult struct {
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	OutputTruncated bool   `json:"outputTruncated"`
+	ExitCode        int    `json:"exitCode"`
+	Signal          string `json:"signal,omitempty"`
+	TimedOut        bool   `json:"timedOut"`
+	WallTime        int64  `json:"wallTime"`
+	CPUTime         int64  `json:"cpuTime"`
 }
 
 type ResponseStatus struct {
@@ -136,13 +311,45 @@ type ProjectStats struct {
 		Timeout      int64   `json:"timeout"`
 		TotalSeconds float64 `json:"total_seconds"`
 	} `json:"data"`
+	Commits     *CommitActivity `json:"commits,omitempty"`
+	FetchedAt   string          `json:"fetchedAt,omitempty"`
+	Stale       bool            `json:"stale,omitempty"`
+	Missing     []string        `json:"missing,omitempty"`
+	Unavailable bool            `json:"unavailable,omitempty"`
+}
+
+type CommitActivity struct {
+	Total      int             `json:"total"`
+	Authors    map[string]int  `json:"authors"`
+	Weeks      []WeeklyCommits `json:"weeks"`
+	LastCommit string          `json:"lastCommit,omitempty"`
+}
+
+type WeeklyCommits struct {
+	Week    string `json:"week"`
+	Commits int    `json:"commits"`
+}
+
+type AllStatsResult map[string]ProjectStats
+
+// StatsSnapshot is the all time total of a Wakatime project on a day
+type StatsSnapshot struct {
+	Project      string    `json:"project" bson:"project"`
+	Date         string    `json:"date" bson:"date"`
+	TotalSeconds float64   `json:"totalSeconds" bson:"totalSeconds"`
+	RecordedAt   time.Time `json:"recordedAt" bson:"recordedAt"`
+}
+
+type StatsHistoryPoint struct {
+	Date         string  `json:"date"`
+	TotalSeconds float64 `json:"totalSeconds"`
+	Delta        float64 `json:"delta"`
 }
 
-type AllStatsResult struct {
-	Compiler ProjectStats `json:"compiler"`
-	Website  ProjectStats `json:"website"`
-	Server   ProjectStats `json:"server"`
-	VSCode   ProjectStats `json:"vscode"`
-	Docs     ProjectStats `json:"docs"`
-	Tom      ProjectStats `json:"tom"`
+type StatsHistory struct {
+	Project  string              `json:"project"`
+	Interval string              `json:"interval"`
+	From     string              `json:"from"`
+	To       string              `json:"to"`
+	Points   []StatsHistoryPoint `json:"points"`
 }
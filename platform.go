@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+var platformAliases = map[string]string{
+	"windows": "windows", "win": "windows", "win32": "windows", "win64": "windows",
+	"macos": "macos", "mac": "macos", "darwin": "macos", "osx": "macos", "mac os x": "macos",
+	"linux": "linux", "chrome os": "linux", "chromeos": "linux",
+	"freebsd": "freebsd",
+	"android": "android",
+	"ios":     "ios",
+}
+
+var architectureAliases = map[string]string{
+	"x64": "x64", "x86_64": "x64", "x86-64": "x64", "amd64": "x64",
+	"arm64": "arm64", "aarch64": "arm64", "armv8": "arm64",
+	"x86": "x86", "i386": "x86", "i686": "x86", "386": "x86",
+	"arm": "arm", "armv7": "arm", "armv7l": "arm", "armhf": "arm",
+}
+
+// normalizePlatform maps the names in use for an operating system to one name,
+// so that detected platforms can be compared with those of release files
+func normalizePlatform(platform string) string {
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	if normalized, ok := platformAliases[platform]; ok {
+		return normalized
+	}
+	return platform
+}
+
+func normalizeArchitecture(architecture string) string {
+	architecture = strings.ToLower(strings.TrimSpace(architecture))
+	if normalized, ok := architectureAliases[architecture]; ok {
+		return normalized
+	}
+	return architecture
+}
+
+// detectPlatform guesses the platform and architecture of the client from the
+// User-Agent, preferring the Client Hints when the browser sent them. Either
+// is empty when it could not be detected.
+func detectPlatform(header http.Header) (string, string) {
+	userAgent := header.Get("User-Agent")
+	platform := ""
+	for _, candidate := range []struct{ marker, platform string }{
+		{"Android", "android"},
+		{"iPhone", "ios"},
+		{"iPad", "ios"},
+		{"Windows", "windows"},
+		{"Macintosh", "macos"},
+		{"Mac OS X", "macos"},
+		{"CrOS", "linux"},
+		{"FreeBSD", "freebsd"},
+		{"Linux", "linux"},
+	} {
+		if strings.Contains(userAgent, candidate.marker) {
+			platform = candidate.platform
+			break
+		}
+	}
+	architecture := ""
+	lowerAgent := strings.ToLower(userAgent)
+	for _, candidate := range []struct{ marker, architecture string }{
+		{"aarch64", "arm64"},
+		{"arm64", "arm64"},
+		{"x86_64", "x64"},
+		{"x64", "x64"},
+		{"win64", "x64"},
+		{"wow64", "x64"},
+		{"amd64", "x64"},
+		{"armv7", "arm"},
+		{"i686", "x86"},
+		{"i386", "x86"},
+	} {
+		if strings.Contains(lowerAgent, candidate.marker) {
+			architecture = candidate.architecture
+			break
+		}
+	}
+	if hint := strings.Trim(header.Get("Sec-CH-UA-Platform"), `"`); hint != "" {
+		platform = normalizePlatform(hint)
+	}
+	if hint := strings.Trim(header.Get("Sec-CH-UA-Arch"), `"`); hint != "" {
+		bitness := strings.Trim(header.Get("Sec-CH-UA-Bitness"), `"`)
+		switch {
+		case hint == "x86" && bitness == "32":
+			architecture = "x86"
+		case hint == "x86":
+			architecture = "x64"
+		case hint == "arm" && bitness == "32":
+			architecture = "arm"
+		case hint == "arm":
+			architecture = "arm64"
+		}
+	}
+	return platform, architecture
+}
+
+// rankReleaseFiles orders the files by how well they fit the platform and
+// architecture, and returns whether the first one fits both. Files for other
+// platforms come last, and x64 is preferred when the architecture is unknown.
+func rankReleaseFiles(files []ReleaseFile, platform string, architecture string) ([]ReleaseFile, bool) {
+	score := func(file ReleaseFile) int {
+		result := 0
+		if normalizePlatform(file.Platform) == platform {
+			result += 4
+		}
+		fileArchitecture := normalizeArchitecture(file.Architecture)
+		if fileArchitecture == architecture {
+			result += 2
+		} else if architecture == "" && fileArchitecture == "x64" {
+			result += 1
+		}
+		return result
+	}
+	ranked := append([]ReleaseFile(nil), files...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return score(ranked[i]) > score(ranked[j])
+	})
+	fits := len(ranked) > 0 && platform != "" && score(ranked[0]) >= 4 && (architecture == "" || score(ranked[0]) >= 6)
+	return ranked, fits
+}
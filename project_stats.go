@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultStatsProjects is used until a project list is stored in the config
+var defaultStatsProjects = []StatsProject{
+	{Key: "compiler", Name: "qat", Visible: true},
+	{Key: "website", Name: "qatdev", Visible: true},
+	{Key: "server", Name: "QatDevServer", Visible: true},
+	{Key: "vscode", Name: "qat_vscode", Visible: true},
+	{Key: "docs", Name: "QatDocs", Visible: true},
+	{Key: "tom", Name: "tom", Visible: true},
+}
+
+func statsProjectsOf(config *ServerConfig) []StatsProject {
+	if config == nil || len(config.Projects) == 0 {
+		return append([]StatsProject(nil), defaultStatsProjects...)
+	}
+	return config.Projects
+}
+
+type cachedProjectStats struct {
+	apply     func(*ProjectStats)
+	fetchedAt time.Time
+}
+
+// ProjectStatsService fetches the stats of all projects from every provider
+// concurrently and caches them for ttl. Once the cache is stale it is still
+// served while a refresh runs in the background, and a provider that failed
+// for a project keeps its last known stats, so a provider being down only
+// makes the stats stale.
+type ProjectStatsService struct {
+	configs   ConfigStore
+	providers []StatsProvider
+	ttl       time.Duration
+	mu        sync.Mutex
+	editMu    sync.Mutex
+	projects  []StatsProject
+	cache     map[string]map[string]cachedProjectStats
+	inflight  chan struct{}
+	lastRun   time.Time
+}
+
+func NewProjectStatsService(configs ConfigStore, ttl time.Duration, providers ...StatsProvider) *ProjectStatsService {
+	cache := make(map[string]map[string]cachedProjectStats)
+	for _, provider := range providers {
+		cache[provider.Name()] = make(map[string]cachedProjectStats)
+	}
+	return &ProjectStatsService{
+		configs:   configs,
+		providers: providers,
+		ttl:       ttl,
+		projects:  statsProjectsOf(nil),
+		cache:     cache,
+	}
+}
+
+func (service *ProjectStatsService) StartRefreshing() {
+	go func() {
+		for {
+			<-service.refresh()
+			time.Sleep(service.ttl)
+		}
+	}()
+}
+
+// refresh starts fetching all projects unless a refresh is already running,
+// and returns a channel that is closed once the running refresh is done.
+func (service *ProjectStatsService) refresh() <-chan struct{} {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if service.inflight != nil {
+		return service.inflight
+	}
+	done := make(chan struct{})
+	service.inflight = done
+	service.lastRun = time.Now()
+	go func() {
+		defer func() {
+			service.mu.Lock()
+			service.inflight = nil
+			service.mu.Unlock()
+			close(done)
+		}()
+		config, err := service.configs.Get(context.Background())
+		if err != nil && err != ErrNotFound {
+			log.Println("Could not retrieve server config for project stats: ", err)
+			return
+		}
+		projects := statsProjectsOf(config)
+		byName := make(map[string]StatsProject, len(projects))
+		for _, project := range projects {
+			byName[project.Name] = project
+		}
+		service.mu.Lock()
+		service.projects = projects
+		for _, cache := range service.cache {
+			for name := range cache {
+				if _, ok := byName[name]; !ok {
+					delete(cache, name)
+				}
+			}
+		}
+		service.mu.Unlock()
+		var wg sync.WaitGroup
+		for _, provider := range service.providers {
+			for _, project := range byName {
+				wg.Add(1)
+				go func(provider StatsProvider, project StatsProject) {
+					defer wg.Done()
+					apply, err := provider.Fetch(context.Background(), project)
+					if err != nil {
+						log.Println(err.Error())
+						return
+					}
+					service.mu.Lock()
+					service.cache[provider.Name()][project.Name] = cachedProjectStats{apply: apply, fetchedAt: time.Now()}
+					service.mu.Unlock()
+				}(provider, project)
+			}
+		}
+		wg.Wait()
+	}()
+	return done
+}
+
+// Projects returns the tracked projects stored in the config, or the
+// defaults if none have been stored yet.
+func (service *ProjectStatsService) Projects(ctx context.Context) ([]StatsProject, error) {
+	config, err := service.configs.Get(ctx)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	return statsProjectsOf(config), nil
+}
+
+// editProjects stores the project list returned by edit and refreshes the
+// stats, so that changes show up without waiting for the next refresh.
+func (service *ProjectStatsService) editProjects(ctx context.Context, edit func([]StatsProject) ([]StatsProject, error)) ([]StatsProject, error) {
+	service.editMu.Lock()
+	defer service.editMu.Unlock()
+	projects, err := service.Projects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	projects, err = edit(projects)
+	if err != nil {
+		return nil, err
+	}
+	err = service.configs.SetStatsProjects(ctx, projects)
+	if err != nil {
+		return nil, err
+	}
+	service.refresh()
+	return projects, nil
+}
+
+// SetProject adds the project, or replaces the project with the same key
+func (service *ProjectStatsService) SetProject(ctx context.Context, project StatsProject) ([]StatsProject, error) {
+	return service.editProjects(ctx, func(projects []StatsProject) ([]StatsProject, error) {
+		for i := range projects {
+			if projects[i].Key == project.Key {
+				projects[i] = project
+				return projects, nil
+			}
+		}
+		return append(projects, project), nil
+	})
+}
+
+// RemoveProject returns ErrNotFound if no project has the key
+func (service *ProjectStatsService) RemoveProject(ctx context.Context, key string) ([]StatsProject, error) {
+	return service.editProjects(ctx, func(projects []StatsProject) ([]StatsProject, error) {
+		for i := range projects {
+			if projects[i].Key == key {
+				return append(projects[:i], projects[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// Get returns the combined stats of every visible project. It only waits for
+// the providers when nothing has been cached yet, otherwise stale or missing
+// entries trigger a refresh in the background, at most once a minute, and are
+// returned as they are. The oldest fetch time of the providers is reported,
+// along with the providers that have no stats for the project.
+func (service *ProjectStatsService) Get(ctx context.Context) AllStatsResult {
+	service.mu.Lock()
+	empty := true
+	for _, cache := range service.cache {
+		empty = empty && len(cache) == 0
+	}
+	service.mu.Unlock()
+	if empty {
+		select {
+		case <-service.refresh():
+		case <-ctx.Done():
+		}
+	}
+	service.mu.Lock()
+	result := make(AllStatsResult, len(service.projects))
+	anyStale := false
+	for _, project := range service.projects {
+		if !project.Visible {
+			continue
+		}
+		var stats ProjectStats
+		var oldest time.Time
+		for _, provider := range service.providers {
+			cached, ok := service.cache[provider.Name()][project.Name]
+			if !ok {
+				stats.Missing = append(stats.Missing, provider.Name())
+				anyStale = true
+				continue
+			}
+			cached.apply(&stats)
+			if oldest.IsZero() || cached.fetchedAt.Before(oldest) {
+				oldest = cached.fetchedAt
+			}
+		}
+		if oldest.IsZero() {
+			result[project.Key] = ProjectStats{Missing: stats.Missing, Unavailable: true}
+			continue
+		}
+		stats.FetchedAt = oldest.UTC().Format(time.RFC3339)
+		stats.Stale = time.Since(oldest) > service.ttl
+		anyStale = anyStale || stats.Stale
+		result[project.Key] = stats
+	}
+	retry := !empty && anyStale && time.Since(service.lastRun) > time.Minute
+	service.mu.Unlock()
+	if retry {
+		service.refresh()
+	}
+	return result
+}
+
+// Totals waits for a refresh and returns the total seconds tracked by
+// Wakatime for every project by name, along with how many projects had no
+// fresh stats.
+func (service *ProjectStatsService) Totals(ctx context.Context) (map[string]float64, int) {
+	select {
+	case <-service.refresh():
+	case <-ctx.Done():
+	}
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	totals := make(map[string]float64, len(service.projects))
+	missing := 0
+	for _, project := range service.projects {
+		cached, ok := service.cache[wakatimeProviderName][project.Name]
+		if !ok || time.Since(cached.fetchedAt) > service.ttl {
+			missing++
+			continue
+		}
+		var stats ProjectStats
+		cached.apply(&stats)
+		totals[project.Name] = stats.Data.TotalSeconds
+	}
+	return totals, missing
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStatsProvider returns the stats set for a project, and fails for the
+// projects it has none for.
+type fakeStatsProvider struct {
+	name    string
+	mu      sync.Mutex
+	calls   int
+	seconds map[string]float64
+	commits map[string]int
+}
+
+func (provider *fakeStatsProvider) Name() string {
+	return provider.name
+}
+
+func (provider *fakeStatsProvider) Fetch(ctx context.Context, project StatsProject) (func(*ProjectStats), error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.calls++
+	if seconds, ok := provider.seconds[project.Name]; ok {
+		return func(stats *ProjectStats) {
+			stats.Data.TotalSeconds = seconds
+		}, nil
+	}
+	if commits, ok := provider.commits[project.Name]; ok {
+		return func(stats *ProjectStats) {
+			stats.Commits = &CommitActivity{Total: commits}
+		}, nil
+	}
+	return nil, errors.New("no stats of " + project.Name)
+}
+
+func (provider *fakeStatsProvider) set(seconds map[string]float64, commits map[string]int) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	provider.seconds = seconds
+	provider.commits = commits
+}
+
+func (provider *fakeStatsProvider) fetched() int {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	return provider.calls
+}
+
+func newFakeStatsService(t *testing.T, providers ...StatsProvider) *ProjectStatsService {
+	t.Helper()
+	configs := NewMemoryStores().Config
+	err := configs.SetStatsProjects(context.Background(), []StatsProject{
+		{Key: "compiler", Name: "qat", Visible: true},
+		{Key: "docs", Name: "QatDocs", Visible: true},
+		{Key: "hidden", Name: "secret", Visible: false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewProjectStatsService(configs, time.Hour, providers...)
+}
+
+type expectedStats struct {
+	seconds     float64
+	commits     int
+	missing     string
+	unavailable bool
+}
+
+func TestProjectStatsAggregation(t *testing.T) {
+	tests := []struct {
+		name     string
+		seconds  map[string]float64
+		commits  map[string]int
+		expected map[string]expectedStats
+	}{
+		{
+			name:    "combines every provider",
+			seconds: map[string]float64{"qat": 10, "QatDocs": 20, "secret": 30},
+			commits: map[string]int{"qat": 3, "QatDocs": 4, "secret": 5},
+			expected: map[string]expectedStats{
+				"compiler": {seconds: 10, commits: 3},
+				"docs":     {seconds: 20, commits: 4},
+			},
+		},
+		{
+			name:    "reports a failing provider as missing",
+			seconds: map[string]float64{"qat": 10},
+			commits: map[string]int{"qat": 3, "QatDocs": 4},
+			expected: map[string]expectedStats{
+				"compiler": {seconds: 10, commits: 3},
+				"docs":     {commits: 4, missing: "wakatime"},
+			},
+		},
+		{
+			name:    "marks projects without any stats unavailable",
+			seconds: map[string]float64{"qat": 10},
+			expected: map[string]expectedStats{
+				"compiler": {seconds: 10, missing: "commits"},
+				"docs":     {missing: "wakatime,commits", unavailable: true},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wakatime := &fakeStatsProvider{name: wakatimeProviderName, seconds: test.seconds}
+			commits := &fakeStatsProvider{name: commitsProviderName, commits: test.commits}
+			result := newFakeStatsService(t, wakatime, commits).Get(context.Background())
+			if len(result) != len(test.expected) {
+				t.Errorf("expected %d projects, got %+v", len(test.expected), result)
+			}
+			for key, expected := range test.expected {
+				stats := result[key]
+				actual := expectedStats{
+					seconds:     stats.Data.TotalSeconds,
+					missing:     strings.Join(stats.Missing, ","),
+					unavailable: stats.Unavailable,
+				}
+				if stats.Commits != nil {
+					actual.commits = stats.Commits.Total
+				}
+				if actual != expected {
+					t.Errorf("expected %s to be %+v, got %+v", key, expected, actual)
+				}
+				if !stats.Unavailable && (stats.FetchedAt == "" || stats.Stale) {
+					t.Errorf("expected fresh stats of %s, got %+v", key, stats)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectStatsCaching(t *testing.T) {
+	provider := &fakeStatsProvider{name: wakatimeProviderName, seconds: map[string]float64{"qat": 10, "QatDocs": 20, "secret": 30}}
+	service := newFakeStatsService(t, provider)
+	service.Get(context.Background())
+	service.Get(context.Background())
+	if calls := provider.fetched(); calls != 3 {
+		t.Fatalf("expected the cached stats to be served, got %d fetches", calls)
+	}
+
+	provider.set(map[string]float64{"qat": 15}, nil)
+	<-service.refresh()
+	if calls := provider.fetched(); calls != 6 {
+		t.Fatalf("expected every project to be fetched again, got %d fetches", calls)
+	}
+	service.ttl = time.Nanosecond
+	result := service.Get(context.Background())
+	if stats := result["compiler"]; stats.Data.TotalSeconds != 15 {
+		t.Errorf("expected the refreshed stats, got %+v", stats)
+	}
+	if stats := result["docs"]; stats.Data.TotalSeconds != 20 || !stats.Stale {
+		t.Errorf("expected the last known stats to be kept as stale, got %+v", stats)
+	}
+}
+
+func TestCommitActivity(t *testing.T) {
+	commit := func(author string, timestamp string) NewCommit {
+		var commit NewCommit
+		commit.Author.Name = author
+		commit.Timestamp = timestamp
+		return commit
+	}
+	commits := []NewCommit{
+		commit("ada", "2026-03-10T12:00:00Z"),
+		commit("ada", "2026-03-03T08:00:00Z"),
+		commit("bob", "2026-02-20T08:00:00Z"),
+		commit("bob", "not a time"),
+	}
+	activity := commitActivity(commits, 2, time.Date(2026, 3, 11, 15, 0, 0, 0, time.UTC))
+	if activity.Total != 4 || activity.Authors["ada"] != 2 || activity.Authors["bob"] != 2 {
+		t.Errorf("unexpected totals %+v", activity)
+	}
+	if len(activity.Weeks) != 2 || activity.Weeks[0] != (WeeklyCommits{"2026-03-02", 1}) || activity.Weeks[1] != (WeeklyCommits{"2026-03-09", 1}) {
+		t.Errorf("unexpected weeks %+v", activity.Weeks)
+	}
+	if activity.LastCommit != "2026-03-10T12:00:00Z" {
+		t.Errorf("unexpected last commit %s", activity.LastCommit)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	releaseIDPattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	releaseFileIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	sha256Pattern        = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// ensureReleaseIndexes makes release IDs and indexes unique. Creating a
+// release relies on the unique index to assign the next index, so the server
+// must not start without it.
+func ensureReleaseIndexes(releases *mongo.Collection) error {
+	_, err := releases.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "releaseID", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "index", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
+
+func validateReleaseVersion(version ReleaseVersion) error {
+	if !version.IsPrerelease && version.Prerelease != "" {
+		return errors.New("Prerelease is only allowed for prerelease versions")
+	}
+	_, err := releaseSemVer(version)
+	return err
+}
+
+// releaseChannels decides which releases are part of a channel
+var releaseChannels = map[string]func(LanguageRelease) bool{
+	"stable":     func(release LanguageRelease) bool { return !release.Version.IsPrerelease },
+	"prerelease": func(release LanguageRelease) bool { return release.Version.IsPrerelease },
+	"all":        func(release LanguageRelease) bool { return true },
+}
+
+type releaseSelection struct {
+	channel    string
+	constraint VersionConstraint
+	query      ReleaseQuery
+}
+
+// selectReleases lists the releases matching the selection from the highest
+// version to the lowest
+func selectReleases(ctx context.Context, releases ReleaseStore, selection releaseSelection) ([]LanguageRelease, error) {
+	listed, err := releases.List(ctx, selection.query)
+	if err != nil {
+		return nil, err
+	}
+	selected := filterReleases(listed, selection.channel, selection.constraint)
+	sortReleases(selected)
+	return selected, nil
+}
+
+// releasePage returns up to limit releases following the one the cursor points
+// to. Cursors are the encoded ID of the last release of the previous page.
+func releasePage(releases []LanguageRelease, cursor string, limit int) ([]LanguageRelease, ReleasePage, error) {
+	page := ReleasePage{Limit: limit, Total: len(releases)}
+	start := 0
+	if cursor != "" {
+		releaseID, err := base64.RawURLEncoding.DecodeString(cursor)
+		start = -1
+		for i := range releases {
+			if err == nil && releases[i].ReleaseID == string(releaseID) {
+				start = i + 1
+				break
+			}
+		}
+		if start == -1 {
+			return nil, page, errors.New("Invalid or outdated cursor")
+		}
+	}
+	end := start + limit
+	if end >= len(releases) {
+		end = len(releases)
+	} else {
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(releases[end-1].ReleaseID))
+	}
+	return releases[start:end], page, nil
+}
+
+// fillReleaseContent loads the content of releases that were listed without it
+func fillReleaseContent(ctx context.Context, releases ReleaseStore, page []LanguageRelease) error {
+	if len(page) == 0 {
+		return nil
+	}
+	releaseIDs := make([]string, len(page))
+	for i := range page {
+		releaseIDs[i] = page[i].ReleaseID
+	}
+	full, err := releases.List(ctx, ReleaseQuery{IncludeDrafts: true, ReleaseIDs: releaseIDs})
+	if err != nil {
+		return err
+	}
+	content := make(map[string]string, len(full))
+	for _, release := range full {
+		content[release.ReleaseID] = release.Content
+	}
+	for i := range page {
+		page[i].Content = content[page[i].ReleaseID]
+	}
+	return nil
+}
+
+// filterReleases keeps the releases of the channel that match the constraint.
+// Releases with invalid versions never match a constraint.
+func filterReleases(releases []LanguageRelease, channel string, constraint VersionConstraint) []LanguageRelease {
+	inChannel := releaseChannels[channel]
+	filtered := []LanguageRelease{}
+	for _, release := range releases {
+		if !inChannel(release) {
+			continue
+		}
+		if constraint != nil {
+			version, err := releaseSemVer(release.Version)
+			if err != nil || !constraint.Matches(version) {
+				continue
+			}
+		}
+		filtered = append(filtered, release)
+	}
+	return filtered
+}
+
+func normalizeReleaseFile(file ReleaseFile) ReleaseFile {
+	file.SHA256 = strings.ToLower(strings.TrimSpace(file.SHA256))
+	file.Signature = strings.TrimSpace(file.Signature)
+	return file
+}
+
+func validateReleaseFile(file ReleaseFile) error {
+	if !releaseFileIDPattern.MatchString(file.Id) {
+		return errors.New("File ID should only contain letters, digits, dots, dashes and underscores")
+	}
+	if file.Platform == "" || file.Architecture == "" || file.Path == "" {
+		return errors.New("File platform, architecture and path are required")
+	}
+	if file.SHA256 != "" && !sha256Pattern.MatchString(file.SHA256) {
+		return errors.New("File SHA-256 checksum should be 64 hexadecimal digits")
+	}
+	if file.Size < 0 {
+		return errors.New("File size cannot be negative")
+	}
+	if len(file.Signature) > 16*1024 {
+		return errors.New("File signature cannot be larger than 16 KB")
+	}
+	return nil
+}
+
+func validateNewRelease(release NewRelease) error {
+	if !releaseIDPattern.MatchString(release.ReleaseID) {
+		return errors.New("Release ID should only contain letters, digits, dots, dashes and underscores")
+	}
+	if err := validateReleaseVersion(release.Version); err != nil {
+		return err
+	}
+	fileIDs := make(map[string]bool, len(release.Files))
+	for _, file := range release.Files {
+		if err := validateReleaseFile(file); err != nil {
+			return err
+		}
+		if fileIDs[file.Id] {
+			return errors.New("File IDs should be unique within the release")
+		}
+		fileIDs[file.Id] = true
+	}
+	return nil
+}
+
+// releaseFileMatches checks the file against the file filters of the query
+func releaseFileMatches(file ReleaseFile, query ReleaseQuery) bool {
+	return (query.Platform == "" || file.Platform == query.Platform) &&
+		(query.Architecture == "" || file.Architecture == query.Architecture) &&
+		(query.Target == "" || file.Target == query.Target)
+}
+
+// findReleaseFile returns the first file of the release matching the file
+// filters of the query
+func findReleaseFile(release LanguageRelease, query ReleaseQuery) *ReleaseFile {
+	for i := range release.Files {
+		if releaseFileMatches(release.Files[i], query) {
+			return &release.Files[i]
+		}
+	}
+	return nil
+}
+
+// releaseFileURL resolves the path of a release file against DOWNLOAD_BASE_URL
+// unless it is an absolute URL already
+func releaseFileURL(filePath string) string {
+	if strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://") {
+		return filePath
+	}
+	baseURL := os.Getenv("DOWNLOAD_BASE_URL")
+	if baseURL == "" {
+		return filePath
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(filePath, "/")
+}
+
+// releaseFileName is the name a release file is downloaded as
+func releaseFileName(file ReleaseFile) string {
+	filePath := file.Path
+	if parsed, err := url.Parse(filePath); err == nil && parsed.Path != "" {
+		filePath = parsed.Path
+	}
+	return path.Base(filePath)
+}
+
+// sha256Sums lists the checksums of the files of the release in the format of
+// sha256sum, skipping files without a checksum
+func sha256Sums(release LanguageRelease) string {
+	var sums strings.Builder
+	for _, file := range release.Files {
+		if file.SHA256 == "" {
+			continue
+		}
+		sums.WriteString(file.SHA256 + "  " + releaseFileName(file) + "\n")
+	}
+	return sums.String()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"time"
+)
+
+type SandboxLimits struct {
+	CPUSeconds    uint64
+	MemoryBytes   uint64
+	FileSizeBytes uint64
+	MaxProcesses  uint64
+	ScratchBytes  uint64
+	WallTimeout   time.Duration
+	MaxOutput     int
+}
+
+func sandboxLimitsFromEnv() SandboxLimits {
+	return SandboxLimits{
+		CPUSeconds:    uint64(envInt("SANDBOX_CPU_SECONDS", 5)),
+		MemoryBytes:   uint64(envInt("SANDBOX_MEMORY_MB", 256)) * 1024 * 1024,
+		FileSizeBytes: uint64(envInt("SANDBOX_FILE_SIZE_MB", 8)) * 1024 * 1024,
+		MaxProcesses:  uint64(envInt("SANDBOX_MAX_PROCESSES", 16)),
+		ScratchBytes:  uint64(envInt("SANDBOX_SCRATCH_MB", 64)) * 1024 * 1024,
+		WallTimeout:   time.Duration(envInt("SANDBOX_WALL_TIMEOUT_SECONDS", 10)) * time.Second,
+		MaxOutput:     envInt("SANDBOX_MAX_OUTPUT_KB", 64) * 1024,
+	}
+}
+
+// limitedBuffer keeps the first max bytes written to it and silently drops the
+// rest, so that a program flooding stdout cannot exhaust the server's memory.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := b.max - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// findBinary looks for the executable produced by the compiler in the build
+// directory, skipping the result file and any other non-executable outputs.
+func findBinary(buildDir string) (string, error) {
+	entries, err := os.ReadDir(buildDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.Mode().Perm()&0111 != 0 && path.Ext(entry.Name()) != ".json" {
+			return path.Join(buildDir, entry.Name()), nil
+		}
+	}
+	return "", errors.New("no executable found in the build directory")
+}
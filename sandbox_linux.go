@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const sandboxHelperArg = "__qat_sandbox_exec__"
+
+// The syscall package does not export RLIMIT_NPROC for linux
+const rlimitNproc = 0x6
+
+// Nor the capability and prctl constants the helper needs to give up its
+// privileges before running the program
+const (
+	capSysAdmin          = 21
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+	prSetNoNewPrivs      = 38
+)
+
+// sandboxLibraryDirs are mounted read-only into the sandbox so that
+// dynamically linked programs can be loaded. Nothing else of the host
+// filesystem is visible to the program.
+var sandboxLibraryDirs = []string{"/lib", "/lib32", "/lib64", "/usr/lib", "/usr/lib32", "/usr/lib64"}
+
+var sandboxDevices = []string{"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom"}
+
+// sandboxSetupFailed is the exit status of the helper when the sandbox could
+// not be set up, in which case it also reports the error on sandboxErrorFd
+const sandboxSetupFailed = 125
+
+const sandboxErrorFd = 3
+
+// The user the helper and the program run as inside the user namespace,
+// which is mapped to the user of the server
+const sandboxUser = 65534
+
+// runSandboxed executes the binary by re-invoking the server executable as a
+// helper inside fresh user, pid, network, ipc, uts and mount namespaces. The
+// helper only keeps CAP_SYS_ADMIN within the user namespace, which it uses to
+// pivot into an empty root with the system libraries, a few devices and a
+// scratch copy of the binary. It then applies the resource limits to itself,
+// gives up its capabilities and execs the binary, so the limits are inherited
+// by the program and anything it spawns. The build directory is never
+// visible to the program.
+func runSandboxed(ctx context.Context, binary string, limits SandboxLimits) (*RunResult, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, errors.New("could not find the server executable for sandboxing")
+	}
+	root, err := os.MkdirTemp("", "qat-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create the sandbox root: %w", err)
+	}
+	defer os.Remove(root)
+	errorReader, errorWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("could not create the sandbox error pipe: %w", err)
+	}
+	defer errorReader.Close()
+	ctx, cancel := context.WithTimeout(ctx, limits.WallTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, self, sandboxHelperArg,
+		strconv.FormatUint(limits.CPUSeconds, 10),
+		strconv.FormatUint(limits.MemoryBytes, 10),
+		strconv.FormatUint(limits.FileSizeBytes, 10),
+		strconv.FormatUint(limits.MaxProcesses, 10),
+		strconv.FormatUint(limits.ScratchBytes, 10),
+		root,
+		binary)
+	cmd.Dir = "/"
+	cmd.Env = []string{"PATH=/usr/bin:/bin"}
+	cmd.ExtraFiles = []*os.File{errorWriter}
+	stdout := &limitedBuffer{max: limits.MaxOutput}
+	stderr := &limitedBuffer{max: limits.MaxOutput}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC |
+			syscall.CLONE_NEWUTS | syscall.CLONE_NEWNS,
+		Credential:                 &syscall.Credential{Uid: sandboxUser, Gid: sandboxUser},
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: sandboxUser, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: sandboxUser, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		AmbientCaps:                []uintptr{capSysAdmin},
+		Setpgid:                    true,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	start := time.Now()
+	err = cmd.Start()
+	errorWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not start sandboxed program: %w", err)
+	}
+	err = cmd.Wait()
+	wallTime := time.Since(start)
+	if setupError, _ := io.ReadAll(io.LimitReader(errorReader, 4096)); len(setupError) > 0 {
+		return nil, fmt.Errorf("could not set up the sandbox: %s", setupError)
+	}
+	result := &RunResult{
+		WallTime: wallTime.Milliseconds(),
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+	if cmd.ProcessState == nil {
+		return nil, fmt.Errorf("could not run sandboxed program: %w", err)
+	}
+	result.CPUTime = (cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()).Milliseconds()
+	result.ExitCode = cmd.ProcessState.ExitCode()
+	if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal().String()
+	}
+	result.Stdout = stdout.buf.String()
+	result.Stderr = stderr.buf.String()
+	result.OutputTruncated = stdout.truncated || stderr.truncated
+	return result, nil
+}
+
+// mountFlags are the flags of the mount the path is on that a bind mount of
+// it in a user namespace has to keep when it is remounted
+func mountFlags(name string) uintptr {
+	var stat syscall.Statfs_t
+	if syscall.Statfs(name, &stat) != nil {
+		return 0
+	}
+	keep := int64(syscall.MS_RDONLY | syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+		syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME)
+	return uintptr(int64(stat.Flags) & keep)
+}
+
+// bindMount mounts source over target, creating target as a directory or an
+// empty file to match source. Unless flags is 0, the mount is then made
+// read-only along with the flags.
+func bindMount(source string, target string, flags uintptr) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else {
+		err = os.MkdirAll(path.Dir(target), 0755)
+		if err == nil {
+			err = os.WriteFile(target, nil, 0644)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	err = syscall.Mount(source, target, "", syscall.MS_BIND|syscall.MS_REC, "")
+	if err != nil || flags == 0 {
+		return err
+	}
+	return syscall.Mount("", target, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|flags|mountFlags(source), "")
+}
+
+// copyIntoSandbox copies the binary into the scratch directory without
+// following symbolic links, so only the regular file the compiler wrote is
+// ever run.
+func copyIntoSandbox(binary string, target string) error {
+	in, err := os.OpenFile(binary, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("the compiled program is not a regular file")
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// enterSandboxRoot builds the filesystem of the sandbox on a tmpfs mounted at
+// root and pivots into it. The only writable place is /sandbox, a tmpfs of
+// scratchBytes holding the copy of the binary.
+func enterSandboxRoot(root string, binary string, scratchBytes uint64) error {
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return err
+	}
+	err = syscall.Mount("tmpfs", root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=755")
+	if err != nil {
+		return err
+	}
+	for _, dir := range sandboxLibraryDirs {
+		info, err := os.Lstat(dir)
+		if err != nil {
+			continue
+		}
+		target := path.Join(root, dir)
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(dir)
+			if err == nil {
+				err = os.MkdirAll(path.Dir(target), 0755)
+			}
+			if err == nil {
+				err = os.Symlink(link, target)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = bindMount(dir, target, syscall.MS_NOSUID|syscall.MS_NODEV)
+		if err != nil {
+			return err
+		}
+	}
+	for _, device := range sandboxDevices {
+		err = bindMount(device, path.Join(root, device), 0)
+		if err != nil {
+			return err
+		}
+	}
+	scratch := path.Join(root, "sandbox")
+	err = os.Mkdir(scratch, 0755)
+	if err == nil {
+		err = syscall.Mount("tmpfs", scratch, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV,
+			"size="+strconv.FormatUint(scratchBytes, 10)+",mode=755")
+	}
+	if err == nil {
+		err = copyIntoSandbox(binary, path.Join(scratch, path.Base(binary)))
+	}
+	if err == nil {
+		err = os.Mkdir(path.Join(root, ".old"), 0700)
+	}
+	if err != nil {
+		return err
+	}
+	err = syscall.PivotRoot(root, path.Join(root, ".old"))
+	if err != nil {
+		return err
+	}
+	err = syscall.Chdir("/")
+	if err == nil {
+		err = syscall.Unmount("/.old", syscall.MNT_DETACH)
+	}
+	if err == nil {
+		err = os.Remove("/.old")
+	}
+	if err != nil {
+		return err
+	}
+	err = syscall.Mount("", "/", "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, "")
+	if err != nil {
+		return err
+	}
+	return syscall.Chdir("/sandbox")
+}
+
+// sandboxSetupFailure reports the error to the server and exits with the
+// status reserved for it, so it is not mistaken for a failure of the program
+func sandboxSetupFailure(format string, args ...interface{}) {
+	errorPipe := os.NewFile(sandboxErrorFd, "sandbox errors")
+	fmt.Fprintf(errorPipe, format, args...)
+	os.Exit(sandboxSetupFailed)
+}
+
+func sandboxHelperMain(args []string) {
+	syscall.CloseOnExec(sandboxErrorFd)
+	if len(args) != 7 {
+		sandboxSetupFailure("sandbox helper expects 7 arguments, got %d", len(args))
+	}
+	scratchBytes, err := strconv.ParseUint(args[4], 10, 64)
+	if err != nil {
+		sandboxSetupFailure("invalid sandbox scratch size %s", args[4])
+	}
+	binary := args[6]
+	err = enterSandboxRoot(args[5], binary, scratchBytes)
+	if err != nil {
+		sandboxSetupFailure("could not set up the sandbox filesystem: %s", err)
+	}
+	resources := []int{syscall.RLIMIT_CPU, syscall.RLIMIT_AS, syscall.RLIMIT_FSIZE, rlimitNproc}
+	for i, resource := range resources {
+		value, err := strconv.ParseUint(args[i], 10, 64)
+		if err != nil {
+			sandboxSetupFailure("invalid sandbox limit %s", args[i])
+		}
+		err = syscall.Setrlimit(resource, &syscall.Rlimit{Cur: value, Max: value})
+		if err != nil {
+			sandboxSetupFailure("could not apply sandbox limit %d: %s", resource, err)
+		}
+	}
+	syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0)
+	if errno == 0 {
+		_, _, errno = syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0)
+	}
+	if errno != 0 {
+		sandboxSetupFailure("could not drop the sandbox privileges: %s", errno)
+	}
+	err = syscall.Exec(path.Join("/sandbox", path.Base(binary)), []string{path.Base(binary)}, []string{"PATH=/usr/bin:/bin"})
+	sandboxSetupFailure("could not execute sandboxed program: %s", err)
+}
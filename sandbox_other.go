@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+const sandboxHelperArg = "__qat_sandbox_exec__"
+
+func runSandboxed(ctx context.Context, binary string, limits SandboxLimits) (*RunResult, error) {
+	return nil, errors.New("sandboxed execution is only supported on linux")
+}
+
+func sandboxHelperMain(args []string) {
+	log.Fatalf("Sandboxed execution is only supported on linux")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a semantic version. Build metadata is dropped when parsing, as it
+// has no bearing on precedence.
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease []string
+}
+
+// isNumericIdentifier checks whether the identifier only consists of digits,
+// unlike strconv.Atoi which also accepts signs.
+func isNumericIdentifier(identifier string) bool {
+	return identifier != "" && strings.Trim(identifier, "0123456789") == ""
+}
+
+func parseVersionNumber(part string) (int, error) {
+	if !isNumericIdentifier(part) || (len(part) > 1 && part[0] == '0') {
+		return 0, errors.New("invalid version number " + part)
+	}
+	return strconv.Atoi(part)
+}
+
+func ParseSemVer(value string) (SemVer, error) {
+	var version SemVer
+	if plus := strings.IndexByte(value, '+'); plus != -1 {
+		value = value[:plus]
+	}
+	core := value
+	if dash := strings.IndexByte(value, '-'); dash != -1 {
+		core = value[:dash]
+		version.Prerelease = strings.Split(value[dash+1:], ".")
+		for _, identifier := range version.Prerelease {
+			if identifier == "" || strings.Trim(identifier, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-") != "" {
+				return version, fmt.Errorf("invalid prerelease in version %s", value)
+			}
+			if isNumericIdentifier(identifier) && len(identifier) > 1 && identifier[0] == '0' {
+				return version, fmt.Errorf("numeric prerelease identifiers cannot have leading zeros in version %s", value)
+			}
+		}
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return version, fmt.Errorf("version %s should be in the form MAJOR.MINOR.PATCH", value)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		number, err := parseVersionNumber(part)
+		if err != nil {
+			return version, fmt.Errorf("version %s should be in the form MAJOR.MINOR.PATCH", value)
+		}
+		numbers[i] = number
+	}
+	version.Major, version.Minor, version.Patch = numbers[0], numbers[1], numbers[2]
+	return version, nil
+}
+
+func (version SemVer) String() string {
+	result := fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch)
+	if len(version.Prerelease) > 0 {
+		result += "-" + strings.Join(version.Prerelease, ".")
+	}
+	return result
+}
+
+func compareInts(a int, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1 by the precedence rules of semantic versioning
+func (version SemVer) Compare(other SemVer) int {
+	if result := compareInts(version.Major, other.Major); result != 0 {
+		return result
+	}
+	if result := compareInts(version.Minor, other.Minor); result != 0 {
+		return result
+	}
+	if result := compareInts(version.Patch, other.Patch); result != 0 {
+		return result
+	}
+	if len(version.Prerelease) == 0 || len(other.Prerelease) == 0 {
+		return -compareInts(len(version.Prerelease), len(other.Prerelease))
+	}
+	for i := 0; i < len(version.Prerelease) && i < len(other.Prerelease); i++ {
+		a, b := version.Prerelease[i], other.Prerelease[i]
+		aNumeric, bNumeric := isNumericIdentifier(a), isNumericIdentifier(b)
+		switch {
+		case aNumeric && bNumeric:
+			// Without leading zeros the longer number is the larger one, which
+			// also holds for numbers too large for an int
+			if result := compareInts(len(a), len(b)); result != 0 {
+				return result
+			}
+			if result := strings.Compare(a, b); result != 0 {
+				return result
+			}
+		case aNumeric:
+			return -1
+		case bNumeric:
+			return 1
+		default:
+			if result := strings.Compare(a, b); result != 0 {
+				return result
+			}
+		}
+	}
+	return compareInts(len(version.Prerelease), len(other.Prerelease))
+}
+
+// releaseSemVer combines the version value of the release with its prerelease
+func releaseSemVer(version ReleaseVersion) (SemVer, error) {
+	if strings.ContainsAny(version.Value, "-+") {
+		return SemVer{}, errors.New("version " + version.Value + " should be in the form MAJOR.MINOR.PATCH")
+	}
+	if version.IsPrerelease {
+		return ParseSemVer(version.Value + "-" + version.Prerelease)
+	}
+	return ParseSemVer(version.Value)
+}
+
+// sortReleases orders the releases from the highest version to the lowest.
+// Releases with invalid versions come last, ordered by their index.
+func sortReleases(releases []LanguageRelease) {
+	versions := make(map[string]*SemVer, len(releases))
+	for _, release := range releases {
+		if version, err := releaseSemVer(release.Version); err == nil {
+			versions[release.ReleaseID] = &version
+		}
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		a, b := versions[releases[i].ReleaseID], versions[releases[j].ReleaseID]
+		if a != nil && b != nil {
+			return a.Compare(*b) > 0
+		}
+		if a != nil || b != nil {
+			return a != nil
+		}
+		return releases[i].Index > releases[j].Index
+	})
+}
+
+type versionComparator struct {
+	operator string
+	version  SemVer
+}
+
+func (comparator versionComparator) matches(version SemVer) bool {
+	result := version.Compare(comparator.version)
+	switch comparator.operator {
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	case "!=":
+		return result != 0
+	}
+	return result == 0
+}
+
+// VersionConstraint is a set of alternatives separated by ||, each of which is
+// a list of comparators separated by spaces or commas that all have to match.
+// Comparators are a version optionally prefixed by =, !=, >, >=, <, <=, ^ or ~.
+type VersionConstraint [][]versionComparator
+
+var versionOperators = []string{">=", "<=", "!=", ">", "<", "=", "^", "~"}
+
+func ParseVersionConstraint(constraint string) (VersionConstraint, error) {
+	var result VersionConstraint
+	for _, alternative := range strings.Split(constraint, "||") {
+		var comparators []versionComparator
+		fields := strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' })
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			operator := "="
+			for _, candidate := range versionOperators {
+				if strings.HasPrefix(field, candidate) {
+					operator = candidate
+					field = strings.TrimPrefix(field, candidate)
+					break
+				}
+			}
+			if field == "" && i+1 < len(fields) {
+				i++
+				field = fields[i]
+			}
+			version, err := ParseSemVer(strings.TrimPrefix(field, "v"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %s: %w", constraint, err)
+			}
+			switch operator {
+			case "^":
+				upper := SemVer{Major: version.Major + 1, Prerelease: []string{"0"}}
+				if version.Major == 0 {
+					upper = SemVer{Minor: version.Minor + 1, Prerelease: []string{"0"}}
+				}
+				comparators = append(comparators, versionComparator{">=", version}, versionComparator{"<", upper})
+			case "~":
+				upper := SemVer{Major: version.Major, Minor: version.Minor + 1, Prerelease: []string{"0"}}
+				comparators = append(comparators, versionComparator{">=", version}, versionComparator{"<", upper})
+			default:
+				comparators = append(comparators, versionComparator{operator, version})
+			}
+		}
+		if len(comparators) == 0 {
+			return nil, fmt.Errorf("invalid constraint %s: empty alternative", constraint)
+		}
+		result = append(result, comparators)
+	}
+	return result, nil
+}
+
+func (constraint VersionConstraint) Matches(version SemVer) bool {
+	for _, alternative := range constraint {
+		matches := true
+		for _, comparator := range alternative {
+			matches = matches && comparator.matches(version)
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
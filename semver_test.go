@@ -0,0 +1,140 @@
+package main
+
+import "testing"
+
+func TestParseSemVer(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		valid    bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"0.0.0", "0.0.0", true},
+		{"1.2.3-beta.1", "1.2.3-beta.1", true},
+		{"1.2.3-alpha-1.0", "1.2.3-alpha-1.0", true},
+		{"1.2.3--1", "1.2.3--1", true},
+		{"1.2.3-0a", "1.2.3-0a", true},
+		{"1.2.3+build.5", "1.2.3", true},
+		{"1.2.3-rc.1+build", "1.2.3-rc.1", true},
+		{"1.2", "", false},
+		{"1.2.3.4", "", false},
+		{"01.2.3", "", false},
+		{"1.02.3", "", false},
+		{"1.2.+3", "", false},
+		{"1.2.3-", "", false},
+		{"1.2.3-beta..1", "", false},
+		{"1.2.3-01", "", false},
+		{"1.2.3-beta_1", "", false},
+		{"v1.2.3", "", false},
+	}
+	for _, test := range tests {
+		version, err := ParseSemVer(test.value)
+		if test.valid != (err == nil) {
+			t.Errorf("expected %s to be valid: %t, got %v", test.value, test.valid, err)
+			continue
+		}
+		if test.valid && version.String() != test.expected {
+			t.Errorf("expected %s to parse as %s, got %s", test.value, test.expected, version)
+		}
+	}
+}
+
+func TestSemVerPrecedence(t *testing.T) {
+	ordered := []string{
+		"1.0.0-1",
+		"1.0.0-2",
+		"1.0.0-10",
+		"1.0.0-99999999999999999999",
+		"1.0.0--1",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.1.0",
+		"2.0.0",
+		"10.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, b := mustParseSemVer(t, ordered[i]), mustParseSemVer(t, ordered[j])
+			expected := compareInts(i, j)
+			if result := a.Compare(b); result != expected {
+				t.Errorf("expected %s compared to %s to be %d, got %d", a, b, expected, result)
+			}
+		}
+	}
+	a, b := mustParseSemVer(t, "1.0.0+one"), mustParseSemVer(t, "1.0.0+two")
+	if a.Compare(b) != 0 {
+		t.Errorf("expected build metadata to be ignored")
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matching   []string
+		other      []string
+	}{
+		{"1.2.3", []string{"1.2.3"}, []string{"1.2.4", "1.2.3-beta"}},
+		{"=v1.2.3", []string{"1.2.3"}, []string{"1.2.2"}},
+		{"!=1.2.3", []string{"1.2.4"}, []string{"1.2.3"}},
+		{">1.2.3", []string{"1.2.4", "2.0.0"}, []string{"1.2.3", "1.2.3-rc"}},
+		{">=1.2.3 <2.0.0", []string{"1.2.3", "1.9.9"}, []string{"2.0.0", "2.0.1", "1.2.2"}},
+		{">= 1.2.3, < 1.3.0", []string{"1.2.3", "1.2.9"}, []string{"1.3.0", "1.2.2"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.3.0-beta"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0", "1.2.2"}},
+		{"<1.0.0 || >=2.0.0", []string{"0.9.0", "2.1.0"}, []string{"1.0.0", "1.5.0"}},
+		{"<1.0.0-beta.2", []string{"1.0.0-beta.1", "1.0.0-alpha", "0.9.0"}, []string{"1.0.0-beta.11", "1.0.0"}},
+	}
+	for _, test := range tests {
+		constraint, err := ParseVersionConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("could not parse %s: %s", test.constraint, err)
+			continue
+		}
+		for _, value := range test.matching {
+			if !constraint.Matches(mustParseSemVer(t, value)) {
+				t.Errorf("expected %s to match %s", value, test.constraint)
+			}
+		}
+		for _, value := range test.other {
+			if constraint.Matches(mustParseSemVer(t, value)) {
+				t.Errorf("expected %s not to match %s", value, test.constraint)
+			}
+		}
+	}
+	for _, invalid := range []string{"", "||1.2.3", ">=", "^1.2", "1.2.3 ||", ">= 1.2.3, < 1.3"} {
+		if _, err := ParseVersionConstraint(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestSortReleases(t *testing.T) {
+	releases := []LanguageRelease{
+		{ReleaseID: "a", Index: 1, Version: ReleaseVersion{Value: "0.9.0"}},
+		{ReleaseID: "b", Index: 2, Version: ReleaseVersion{Value: "1.0.0", IsPrerelease: true, Prerelease: "rc.1"}},
+		{ReleaseID: "c", Index: 3, Version: ReleaseVersion{Value: "not a version"}},
+		{ReleaseID: "d", Index: 4, Version: ReleaseVersion{Value: "1.0.0"}},
+		{ReleaseID: "e", Index: 5, Version: ReleaseVersion{Value: "1.0.0-rc.2"}},
+	}
+	sortReleases(releases)
+	if ids := releaseIDs(releases); ids != "d,b,a,e,c" {
+		t.Errorf("unexpected order %s", ids)
+	}
+}
+
+func mustParseSemVer(t *testing.T, value string) SemVer {
+	t.Helper()
+	version, err := ParseSemVer(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
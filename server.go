@@ -1,21 +1,30 @@
 package main
 
 import (
-	"context"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"path"
-	"strings"
+	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
+func envInt(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxHelperArg {
+		sandboxHelperMain(os.Args[2:])
+		return
+	}
 	var err error
 	if len(os.Args) < 2 {
 		err = godotenv.Load(".env")
@@ -27,96 +36,86 @@ func main() {
 	}
 	r := gin.Default()
 	var collections Collections
-	ConnectDB(&collections)
-	dur := time.Duration(4 * time.Hour)
-	periodicChannel := time.Tick(dur)
-	go func() {
-		for {
-			<-periodicChannel
-			res := collections.Config.FindOne(context.Background(), bson.M{})
-			if res == nil {
-				log.Fatalf("Could not retrieve server config")
-			}
-			var config ServerConfig
-			err = res.Decode(&config)
-			if err != nil {
-				log.Fatalf("Error occured while decoding the server config")
-			}
-			wakatimeExpiry, err := time.Parse(time.RFC3339, config.Wakatime.ExpiresAt)
-			if err != nil {
-				diff := time.Until(wakatimeExpiry)
-				if diff.Hours() < 24.0 {
-					reqData := url.Values{
-						"client_id":     {config.Wakatime.ClientID},
-						"client_secret": {config.Wakatime.ClientSecret},
-						"redirect_uri":  {"https://qat.dev"},
-						"refresh_token": {config.Wakatime.RefreshToken},
-						"grant_type":    {"refresh_token"},
-					}
-					resp, err := http.PostForm(config.Wakatime.RefreshURL, reqData)
-					if err != nil {
-						log.Fatalf("Error occured while refreshing the Wakatime token")
-					}
-					var bodyBytes []byte
-					_, err = resp.Body.Read(bodyBytes)
-					if err != nil {
-						log.Fatalf("Error while reading the bytes of the response of refreshing the Wakatime token")
-					}
-					bodyStr := string(bodyBytes)
-					if strings.Contains(bodyStr, "&") {
-						vals := strings.Split(bodyStr, "&")
-						for i := 0; i < len(vals); i++ {
-							if strings.Contains(vals[i], "=") {
-								itemSplit := strings.Split(vals[i], "=")
-								switch itemSplit[0] {
-								case "access_token":
-									config.Wakatime.AccessToken = itemSplit[1]
-								case "refresh_token":
-									config.Wakatime.RefreshToken = itemSplit[1]
-								case "expires_at":
-									{
-										expStr, err := url.QueryUnescape(itemSplit[1])
-										if err != nil {
-											log.Fatalf("Error while decoding token expiry date string")
-										}
-										config.Wakatime.ExpiresAt = expStr
-									}
-								}
-							} else {
-								log.Fatalf("Error parsing item at index %d in the response of refreshing the wakatime token", i)
-							}
-						}
-						updateRes, err := collections.Config.UpdateOne(context.Background(), bson.M{},
-							bson.M{"$set": bson.M{
-								"wakatime.accessToken":  config.Wakatime.AccessToken,
-								"wakatime.refreshToken": config.Wakatime.RefreshToken,
-								"wakatime.expiresAt":    config.Wakatime.ExpiresAt}})
-						if err != nil {
-							log.Fatalf("Error while updating Wakatime configuration")
-						}
-						if updateRes.ModifiedCount != 1 {
-							log.Fatalf("Updating Wakatime configuration failed")
-						}
-					} else {
-						log.Fatalf("Error while parsing the response for refreshing Wakatime token")
-					}
-				}
-			}
-
-		}
-	}()
+	var stores *Stores
+	if os.Getenv("STORAGE") == "memory" {
+		log.Println("Using in-memory storage")
+		stores = NewMemoryStores()
+	} else {
+		ConnectDB(&collections)
+		stores = NewMongoStores(&collections)
+	}
+	wakatimeTokens := NewWakatimeTokenManager(stores.Config)
+	wakatimeTokens.Start()
 	if len(os.Args) != 2 {
 		os.RemoveAll(os.Getenv("COMPILE_DIR"))
 	} else {
 		os.RemoveAll(path.Join(os.Args[1], os.Getenv("COMPILE_DIR")))
 	}
-	r.POST("/compile", compileHandler)
-	r.GET("/releases", releaseListHandler(&collections))
-	r.POST("/downloadedRelease", downloadedReleaseHandler(&collections))
-	r.POST("/newCommits", newCommitsHandler(&collections))
-	r.GET("/latestCommit", latestCommitHandler(&collections))
-	r.GET("/releaseCount", releaseCountHandler(&collections))
-	r.GET("/projectStats", projectStatsHandler(&collections))
+	artifactsDir := os.Getenv("ARTIFACTS_DIR")
+	if artifactsDir != "" && len(os.Args) == 2 {
+		artifactsDir = path.Join(os.Args[1], artifactsDir)
+	}
+	artifacts := NewArtifactStore(artifactsDir, time.Duration(envInt("ARTIFACT_TTL_MINUTES", 30))*time.Minute)
+	artifacts.StartJanitor(time.Minute)
+	compileQueue := NewCompileQueue(envInt("COMPILE_WORKERS", runtime.NumCPU()), envInt("COMPILE_QUEUE_DEPTH", 32),
+		time.Duration(envInt("COMPILE_RETRY_AFTER_SECONDS", 5))*time.Second, artifacts)
+	compileCache := NewCompileCache(envInt("COMPILE_CACHE_SIZE", 256), stores.CompileResults)
+	toolchains := NewToolchainRegistry(stores.Releases, os.Getenv("TOOLCHAINS_DIR"))
+	toolchains.StartRefreshing(time.Duration(envInt("TOOLCHAINS_REFRESH_MINUTES", 10)) * time.Minute)
+	r.POST("/compile", compileHandler(compileQueue, compileCache, toolchains))
+	r.POST("/compile/stream", compileStreamHandler(compileQueue, compileCache, toolchains))
+	r.GET("/compilers", compilersHandler(toolchains))
+	r.GET("/artifacts/:id/:file", artifactHandler(artifacts))
+	r.POST("/snippets", newSnippetHandler(stores.Snippets))
+	r.GET("/snippets/:id", snippetHandler(stores.Snippets))
+	r.GET("/releases", releaseListHandler(stores.Releases))
+	r.GET("/releases/latest", latestReleaseHandler(stores.Releases))
+	r.GET("/releases/recommended", recommendedReleaseHandler(stores.Releases))
+	r.GET("/releases/:releaseID/SHA256SUMS", sha256SumsHandler(stores.Releases))
+	r.GET("/releases/:releaseID/files/:fileID/signature", releaseSignatureHandler(stores.Releases))
+	r.POST("/downloadedRelease", downloadedReleaseHandler(stores.Releases))
+	r.GET("/download/:releaseID/:platformID", downloadHandler(stores.Releases))
+	r.GET("/download/latest/:platform/:arch", latestDownloadHandler(stores.Releases))
+	r.POST("/newCommits", newCommitsHandler(stores.Commits))
+	r.GET("/latestCommit", latestCommitHandler(stores.Commits))
+	r.GET("/releaseCount", releaseCountHandler(stores.Releases))
+	r.GET("/admin/releases", adminReleaseListHandler(stores.Releases))
+	r.POST("/admin/releases", createReleaseHandler(stores.Releases))
+	r.PUT("/admin/releases/:releaseID", updateReleaseHandler(stores.Releases))
+	r.POST("/admin/releases/:releaseID/publish", publishReleaseHandler(stores.Releases, true))
+	r.POST("/admin/releases/:releaseID/unpublish", publishReleaseHandler(stores.Releases, false))
+	r.DELETE("/admin/releases/:releaseID", deleteReleaseHandler(stores.Releases))
+	r.PUT("/admin/releases/:releaseID/files/:fileID", setReleaseFileHandler(stores.Releases))
+	r.DELETE("/admin/releases/:releaseID/files/:fileID", removeReleaseFileHandler(stores.Releases))
+	blobsDir := os.Getenv("BLOBS_DIR")
+	if blobsDir == "" {
+		blobsDir = "blobs"
+	}
+	if len(os.Args) == 2 {
+		blobsDir = path.Join(os.Args[1], blobsDir)
+	}
+	blobs := NewBlobStoreFromEnv(blobsDir)
+	r.POST("/admin/releases/:releaseID/files/:fileID/upload", uploadReleaseFileHandler(stores.Releases, blobs))
+	r.GET("/storage/*key", blobHandler(blobs))
+	r.HEAD("/storage/*key", blobHandler(blobs))
+	r.GET("/install.sh", installScriptHandler(stores.Releases, false))
+	r.GET("/install.ps1", installScriptHandler(stores.Releases, true))
+	r.GET("/feeds/releases", releaseFeedHandler(stores.Releases))
+	r.GET("/feeds/updates", updateFeedHandler(stores.Updates))
+	projectStats := NewProjectStatsService(stores.Config, time.Duration(envInt("PROJECT_STATS_TTL_MINUTES", 15))*time.Minute,
+		NewWakatimeStatsProvider(stores.Config), NewCommitStatsProvider(stores.Commits, envInt("COMMIT_ACTIVITY_WEEKS", 12)))
+	projectStats.StartRefreshing()
+	r.GET("/projectStats", projectStatsHandler(projectStats))
+	NewStatsHistoryRecorder(projectStats, stores.StatsHistory).Start()
+	r.GET("/projectStats/history", projectStatsHistoryHandler(projectStats, stores.StatsHistory))
+	r.GET("/admin/projects", statsProjectsHandler(projectStats))
+	r.POST("/admin/projects", setStatsProjectHandler(projectStats))
+	r.DELETE("/admin/projects/:key", removeStatsProjectHandler(projectStats))
+	r.GET("/wakatime/status", wakatimeStatusHandler(wakatimeTokens))
+	wakatimeAuthorizer := NewWakatimeAuthorizer(stores.Config, wakatimeTokens)
+	r.POST("/admin/wakatime/authorize", wakatimeAuthorizeHandler(wakatimeAuthorizer))
+	r.GET("/admin/wakatime/callback", wakatimeCallbackHandler(wakatimeAuthorizer))
+	r.GET("/admin/wakatime/status", wakatimeAdminStatusHandler(wakatimeTokens))
 	err = r.Run(os.Getenv("HOST") + ":" + os.Getenv("PORT"))
 	if err != nil {
 		log.Println("Server connection failed")
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const snippetIDAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newSnippetID returns a random base62 ID. With 12 characters there are about
+// 71 bits of randomness, which keeps the IDs short while not guessable.
+func newSnippetID() (string, error) {
+	return randomID(12)
+}
+
+func randomID(length int) (string, error) {
+	id := make([]byte, length)
+	max := big.NewInt(int64(len(snippetIDAlphabet)))
+	for i := range id {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id[i] = snippetIDAlphabet[n.Int64()]
+	}
+	return string(id), nil
+}
+
+func snippetHash(files map[string]string, entryPoint string, compiler string) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "compiler=%s\nentry=%s\n", compiler, entryPoint)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(hash, "file=%s:%d\n", name, len(files[name]))
+		hash.Write([]byte(files[name]))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ensureSnippetIndexes makes snippet IDs unique, speeds up the lookup by hash
+// for deduplication and lets MongoDB delete snippets once they have expired.
+func ensureSnippetIndexes(snippets *mongo.Collection) {
+	_, err := snippets.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "hash", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Println("Error while creating snippet indexes: ", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const statsDateLayout = "2006-01-02"
+
+var statsHistoryIntervals = map[string]bool{"daily": true, "weekly": true, "monthly": true}
+
+func ensureStatsHistoryIndexes(history *mongo.Collection) {
+	_, err := history.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "project", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Println("Error while creating stats history indexes: ", err)
+	}
+}
+
+// StatsHistoryRecorder stores a snapshot of the total time of every tracked
+// project once a day. Snapshots replace the earlier one of the same day, so
+// recording again after a restart or a failed attempt is harmless.
+type StatsHistoryRecorder struct {
+	stats   *ProjectStatsService
+	history StatsHistoryStore
+	retry   time.Duration
+}
+
+func NewStatsHistoryRecorder(stats *ProjectStatsService, history StatsHistoryStore) *StatsHistoryRecorder {
+	return &StatsHistoryRecorder{stats: stats, history: history, retry: time.Hour}
+}
+
+func (recorder *StatsHistoryRecorder) Start() {
+	go func() {
+		for {
+			wait := time.Until(time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour))
+			if err := recorder.Record(context.Background()); err != nil {
+				log.Println("Recording project stats history failed: ", err)
+				if wait > recorder.retry {
+					wait = recorder.retry
+				}
+			}
+			time.Sleep(wait)
+		}
+	}()
+}
+
+// Record stores today's snapshot of every project with up to date stats, and
+// fails if any tracked project had none.
+func (recorder *StatsHistoryRecorder) Record(ctx context.Context) error {
+	totals, missing := recorder.stats.Totals(ctx)
+	now := time.Now().UTC()
+	for project, total := range totals {
+		err := recorder.history.Record(ctx, StatsSnapshot{
+			Project:      project,
+			Date:         now.Format(statsDateLayout),
+			TotalSeconds: total,
+			RecordedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if missing > 0 {
+		return errors.New("some projects have no up to date stats")
+	}
+	return nil
+}
+
+// statsPeriodStart returns the first day of the period the date is in, weeks
+// starting on Monday.
+func statsPeriodStart(date time.Time, interval string) time.Time {
+	switch interval {
+	case "weekly":
+		return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	case "monthly":
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+// statsHistoryPoints turns the snapshots into one point per period holding the
+// last total of the period, and the time spent since the previous point. The
+// first point is compared with baseline, or its own first snapshot if nil.
+func statsHistoryPoints(snapshots []StatsSnapshot, baseline *StatsSnapshot, interval string) []StatsHistoryPoint {
+	points := []StatsHistoryPoint{}
+	if len(snapshots) == 0 {
+		return points
+	}
+	for _, snapshot := range snapshots {
+		date, err := time.Parse(statsDateLayout, snapshot.Date)
+		if err != nil {
+			continue
+		}
+		period := statsPeriodStart(date, interval).Format(statsDateLayout)
+		if len(points) > 0 && points[len(points)-1].Date == period {
+			points[len(points)-1].TotalSeconds = snapshot.TotalSeconds
+			continue
+		}
+		points = append(points, StatsHistoryPoint{Date: period, TotalSeconds: snapshot.TotalSeconds})
+	}
+	previous := snapshots[0].TotalSeconds
+	if baseline != nil {
+		previous = baseline.TotalSeconds
+	}
+	for i := range points {
+		points[i].Delta = points[i].TotalSeconds - previous
+		previous = points[i].TotalSeconds
+	}
+	return points
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	wakatimeBaseUrl      = "https://wakatime.com/api/v1/users/current/all_time_since_today?project="
+	wakatimeProviderName = "wakatime"
+	commitsProviderName  = "commits"
+)
+
+// StatsProvider fetches one kind of stats of a project. The function it
+// returns adds them to the combined stats of the project, so providers can
+// fail independently and have their last results cached separately.
+type StatsProvider interface {
+	Name() string
+	Fetch(ctx context.Context, project StatsProject) (func(*ProjectStats), error)
+}
+
+// WakatimeStatsProvider fetches the all time coding time of the project
+type WakatimeStatsProvider struct {
+	configs ConfigStore
+	client  *http.Client
+	baseURL string
+}
+
+func NewWakatimeStatsProvider(configs ConfigStore) *WakatimeStatsProvider {
+	return &WakatimeStatsProvider{
+		configs: configs,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: wakatimeBaseUrl,
+	}
+}
+
+func (provider *WakatimeStatsProvider) Name() string {
+	return wakatimeProviderName
+}
+
+func (provider *WakatimeStatsProvider) Fetch(ctx context.Context, project StatsProject) (func(*ProjectStats), error) {
+	config, err := provider.configs.Get(ctx)
+	if err != nil {
+		return nil, errors.New("could not retrieve server config for stats of the " + project.Name + " project")
+	}
+	projectRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.baseURL+project.Name, nil)
+	if err != nil {
+		return nil, errors.New("could not create request for stats of the " + project.Name + " project")
+	}
+	projectRequest.Header.Set("Authorization", "Bearer "+config.Wakatime.AccessToken)
+	resp, err := provider.client.Do(projectRequest)
+	if err != nil {
+		return nil, errors.New("error making request for stats of the " + project.Name + " project")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Wakatime request for the %s project failed with status code: %d", project.Name, resp.StatusCode)
+	}
+	resBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("error reading response for stats of the " + project.Name + " project")
+	}
+	result := new(ProjectStats)
+	err = json.Unmarshal(resBytes, result)
+	if err != nil {
+		return nil, errors.New("error decoding stats of the " + project.Name + " project to JSON")
+	}
+	return func(stats *ProjectStats) {
+		stats.Data = result.Data
+	}, nil
+}
+
+// CommitStatsProvider computes the commit activity of the project from the
+// commits pushed to the server, over the last given number of weeks.
+type CommitStatsProvider struct {
+	commits CommitStore
+	weeks   int
+}
+
+func NewCommitStatsProvider(commits CommitStore, weeks int) *CommitStatsProvider {
+	return &CommitStatsProvider{commits: commits, weeks: weeks}
+}
+
+func (provider *CommitStatsProvider) Name() string {
+	return commitsProviderName
+}
+
+// repositoryMatches checks whether the repository of a commit is the project,
+// which is named with or without the owner of the repository.
+func repositoryMatches(repository string, name string) bool {
+	return repository == name || strings.HasSuffix(repository, "/"+name)
+}
+
+func (provider *CommitStatsProvider) Fetch(ctx context.Context, project StatsProject) (func(*ProjectStats), error) {
+	commits, err := provider.commits.ListByRepository(ctx, project.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve commits of the %s project: %w", project.Name, err)
+	}
+	activity := commitActivity(commits, provider.weeks, time.Now().UTC())
+	return func(stats *ProjectStats) {
+		stats.Commits = activity
+	}, nil
+}
+
+func commitActivity(commits []NewCommit, weeks int, now time.Time) *CommitActivity {
+	activity := &CommitActivity{Total: len(commits), Authors: map[string]int{}, Weeks: []WeeklyCommits{}}
+	firstWeek := statsPeriodStart(now.Truncate(24*time.Hour), "weekly").AddDate(0, 0, -7*(weeks-1))
+	for i := 0; i < weeks; i++ {
+		activity.Weeks = append(activity.Weeks, WeeklyCommits{Week: firstWeek.AddDate(0, 0, 7*i).Format(statsDateLayout)})
+	}
+	var latest time.Time
+	for _, commit := range commits {
+		activity.Authors[commit.Author.Name]++
+		timestamp, err := time.Parse(time.RFC3339, commit.Timestamp)
+		if err != nil {
+			continue
+		}
+		if timestamp.After(latest) {
+			latest = timestamp
+		}
+		week := int(timestamp.UTC().Sub(firstWeek).Hours() / (24 * 7))
+		if timestamp.UTC().Before(firstWeek) || week >= weeks {
+			continue
+		}
+		activity.Weeks[week].Commits++
+	}
+	if !latest.IsZero() {
+		activity.LastCommit = latest.UTC().Format(time.RFC3339)
+	}
+	return activity
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrDuplicateID = errors.New("duplicate ID")
+)
+
+// ReleaseStore returns ErrNotFound from the methods that take a release ID if
+// there is no release with the ID. Get returns drafts too, so callers serving
+// the public have to check for them. Every change after Create sets UpdatedAt.
+type ReleaseStore interface {
+	List(ctx context.Context, query ReleaseQuery) ([]LanguageRelease, error)
+	Get(ctx context.Context, releaseID string) (*LanguageRelease, error)
+	// Count only counts published releases
+	Count(ctx context.Context) (int64, error)
+	// IncrementDownloads returns ErrNotFound if the release has no file with the ID
+	IncrementDownloads(ctx context.Context, releaseID string, fileID string) error
+	// Create assigns the next index to the release, and returns ErrDuplicateID
+	// if a release with the same ID exists
+	Create(ctx context.Context, release LanguageRelease) (*LanguageRelease, error)
+	Update(ctx context.Context, releaseID string, details ReleaseDetails) error
+	SetDraft(ctx context.Context, releaseID string, draft bool) error
+	Delete(ctx context.Context, releaseID string) error
+	// SetFile adds the file, or replaces the file with the same ID keeping its
+	// download count
+	SetFile(ctx context.Context, releaseID string, file ReleaseFile) error
+	// RemoveFile returns ErrNotFound if the release has no file with the ID
+	RemoveFile(ctx context.Context, releaseID string, fileID string) error
+}
+
+func releaseUpdateTime() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+type CommitStore interface {
+	Add(ctx context.Context, commits []NewCommit) error
+	// Latest returns the most recently added commit, or ErrNotFound if there are none
+	Latest(ctx context.Context) (*NewCommit, error)
+	// ListByRepository returns the commits of the repository, which is named
+	// with or without its owner
+	ListByRepository(ctx context.Context, repository string) ([]NewCommit, error)
+}
+
+type ConfigStore interface {
+	Get(ctx context.Context) (*ServerConfig, error)
+	// SetWakatimeTokens only replaces the tokens if the stored refresh token is
+	// still previousRefreshToken, returning ErrNotFound otherwise. An empty
+	// previousRefreshToken replaces the tokens unconditionally.
+	SetWakatimeTokens(ctx context.Context, tokens WakatimeTokens, previousRefreshToken string) error
+	// SetWakatime replaces the whole Wakatime config, creating the server config if needed
+	SetWakatime(ctx context.Context, wakatime WakatimeConfig) error
+	SetStatsProjects(ctx context.Context, projects []StatsProject) error
+}
+
+type UpdateStore interface {
+	List(ctx context.Context) ([]LanguageUpdate, error)
+}
+
+// SnippetStore never returns snippets that have expired
+type SnippetStore interface {
+	Get(ctx context.Context, id string) (*Snippet, error)
+	FindByHash(ctx context.Context, hash string) (*Snippet, error)
+	// Insert returns ErrDuplicateID if a snippet with the same ID exists
+	Insert(ctx context.Context, snippet Snippet) error
+	// SetExpiry removes the expiry of the snippet when expiresAt is nil
+	SetExpiry(ctx context.Context, id string, expiresAt *time.Time) error
+}
+
+type StatsHistoryStore interface {
+	// Record replaces the snapshot of the same project and date if there is one
+	Record(ctx context.Context, snapshot StatsSnapshot) error
+	// Range returns the snapshots of the project from and to the dates, both
+	// inclusive, ordered by date
+	Range(ctx context.Context, project string, from string, to string) ([]StatsSnapshot, error)
+	// LastBefore returns the latest snapshot before the date, or ErrNotFound
+	LastBefore(ctx context.Context, project string, date string) (*StatsSnapshot, error)
+}
+
+// CompileResultStore persists compile results by the key of the compile cache
+type CompileResultStore interface {
+	// Get returns ErrNotFound if no result is stored under the key
+	Get(ctx context.Context, key string) (*SystemCompileResult, error)
+	// Put replaces the result stored under the key if there is one
+	Put(ctx context.Context, key string, result SystemCompileResult) error
+}
+
+// Stores leaves CompileResults nil when compile results are not persisted
+type Stores struct {
+	Releases       ReleaseStore
+	Commits        CommitStore
+	Config         ConfigStore
+	Updates        UpdateStore
+	Snippets       SnippetStore
+	StatsHistory   StatsHistoryStore
+	CompileResults CompileResultStore
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NewMemoryStores returns stores that keep everything in memory, which is used
+// when running the server without a database and for testing handlers.
+func NewMemoryStores() *Stores {
+	return &Stores{
+		Releases:     &MemoryReleaseStore{},
+		Commits:      &MemoryCommitStore{},
+		Config:       &MemoryConfigStore{},
+		Updates:      &MemoryUpdateStore{},
+		Snippets:     &MemorySnippetStore{snippets: make(map[string]Snippet)},
+		StatsHistory: &MemoryStatsHistoryStore{},
+	}
+}
+
+func copyRelease(release LanguageRelease) LanguageRelease {
+	release.Files = append(release.Files[:0:0], release.Files...)
+	return release
+}
+
+type MemoryReleaseStore struct {
+	mu       sync.RWMutex
+	releases []LanguageRelease
+}
+
+func (store *MemoryReleaseStore) Add(release LanguageRelease) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.releases = append(store.releases, copyRelease(release))
+}
+
+func releaseMatches(release LanguageRelease, query ReleaseQuery) bool {
+	if release.Draft && !query.IncludeDrafts {
+		return false
+	}
+	if query.ReleaseIDs != nil {
+		found := false
+		for _, releaseID := range query.ReleaseIDs {
+			found = found || release.ReleaseID == releaseID
+		}
+		if !found {
+			return false
+		}
+	}
+	if query.Platform == "" && query.Architecture == "" && query.Target == "" {
+		return true
+	}
+	return findReleaseFile(release, query) != nil
+}
+
+func (store *MemoryReleaseStore) List(ctx context.Context, query ReleaseQuery) ([]LanguageRelease, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var releases []LanguageRelease
+	for _, release := range store.releases {
+		if !releaseMatches(release, query) {
+			continue
+		}
+		release = copyRelease(release)
+		if query.WithoutContent {
+			release.Content = ""
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+func (store *MemoryReleaseStore) find(releaseID string) *LanguageRelease {
+	for i := range store.releases {
+		if store.releases[i].ReleaseID == releaseID {
+			return &store.releases[i]
+		}
+	}
+	return nil
+}
+
+func (store *MemoryReleaseStore) Get(ctx context.Context, releaseID string) (*LanguageRelease, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	release := store.find(releaseID)
+	if release == nil {
+		return nil, ErrNotFound
+	}
+	result := copyRelease(*release)
+	return &result, nil
+}
+
+func (store *MemoryReleaseStore) Count(ctx context.Context) (int64, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var count int64
+	for _, release := range store.releases {
+		if !release.Draft {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (store *MemoryReleaseStore) IncrementDownloads(ctx context.Context, releaseID string, fileID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	release := store.find(releaseID)
+	if release == nil {
+		return ErrNotFound
+	}
+	for j := range release.Files {
+		if release.Files[j].Id == fileID {
+			release.Files[j].Downloads++
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (store *MemoryReleaseStore) Create(ctx context.Context, release LanguageRelease) (*LanguageRelease, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.find(release.ReleaseID) != nil {
+		return nil, ErrDuplicateID
+	}
+	release.Index = 0
+	for _, existing := range store.releases {
+		if existing.Index >= release.Index {
+			release.Index = existing.Index + 1
+		}
+	}
+	store.releases = append(store.releases, copyRelease(release))
+	return &release, nil
+}
+
+func (store *MemoryReleaseStore) Update(ctx context.Context, releaseID string, details ReleaseDetails) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	release := store.find(releaseID)
+	if release == nil {
+		return ErrNotFound
+	}
+	release.Version = details.Version
+	release.Title = details.Title
+	release.Content = details.Content
+	release.UpdatedAt = releaseUpdateTime()
+	return nil
+}
+
+func (store *MemoryReleaseStore) SetDraft(ctx context.Context, releaseID string, draft bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	release := store.find(releaseID)
+	if release == nil {
+		return ErrNotFound
+	}
+	release.Draft = draft
+	release.UpdatedAt = releaseUpdateTime()
+	return nil
+}
+
+func (store *MemoryReleaseStore) Delete(ctx context.Context, releaseID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i := range store.releases {
+		if store.releases[i].ReleaseID == releaseID {
+			store.releases = append(store.releases[:i], store.releases[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (store *MemoryReleaseStore) SetFile(ctx context.Context, releaseID string, file ReleaseFile) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	release := store.find(releaseID)
+	if release == nil {
+		return ErrNotFound
+	}
+	release.UpdatedAt = releaseUpdateTime()
+	for j := range release.Files {
+		if release.Files[j].Id == file.Id {
+			file.Downloads = release.Files[j].Downloads
+			release.Files[j] = file
+			return nil
+		}
+	}
+	file.Downloads = 0
+	release.Files = append(release.Files, file)
+	return nil
+}
+
+func (store *MemoryReleaseStore) RemoveFile(ctx context.Context, releaseID string, fileID string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	release := store.find(releaseID)
+	if release == nil {
+		return ErrNotFound
+	}
+	for j := range release.Files {
+		if release.Files[j].Id == fileID {
+			release.Files = append(release.Files[:j], release.Files[j+1:]...)
+			release.UpdatedAt = releaseUpdateTime()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+type MemoryCommitStore struct {
+	mu      sync.RWMutex
+	commits []NewCommit
+}
+
+func (store *MemoryCommitStore) Add(ctx context.Context, commits []NewCommit) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.commits = append(store.commits, commits...)
+	return nil
+}
+
+func (store *MemoryCommitStore) Latest(ctx context.Context) (*NewCommit, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if len(store.commits) == 0 {
+		return nil, ErrNotFound
+	}
+	commit := store.commits[len(store.commits)-1]
+	return &commit, nil
+}
+
+func (store *MemoryCommitStore) ListByRepository(ctx context.Context, repository string) ([]NewCommit, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var commits []NewCommit
+	for _, commit := range store.commits {
+		if repositoryMatches(commit.Repository, repository) {
+			commits = append(commits, commit)
+		}
+	}
+	return commits, nil
+}
+
+type MemoryConfigStore struct {
+	mu     sync.RWMutex
+	config *ServerConfig
+}
+
+func (store *MemoryConfigStore) Set(config ServerConfig) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.config = &config
+}
+
+func (store *MemoryConfigStore) Get(ctx context.Context) (*ServerConfig, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	if store.config == nil {
+		return nil, ErrNotFound
+	}
+	config := *store.config
+	config.Projects = append([]StatsProject(nil), config.Projects...)
+	return &config, nil
+}
+
+func (store *MemoryConfigStore) SetWakatimeTokens(ctx context.Context, tokens WakatimeTokens, previousRefreshToken string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.config == nil {
+		return ErrNotFound
+	}
+	if previousRefreshToken != "" && store.config.Wakatime.RefreshToken != previousRefreshToken {
+		return ErrNotFound
+	}
+	store.config.Wakatime.AccessToken = tokens.AccessToken
+	store.config.Wakatime.RefreshToken = tokens.RefreshToken
+	store.config.Wakatime.ExpiresAt = tokens.ExpiresAt
+	return nil
+}
+
+func (store *MemoryConfigStore) SetWakatime(ctx context.Context, wakatime WakatimeConfig) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.config == nil {
+		store.config = &ServerConfig{}
+	}
+	store.config.Wakatime = wakatime
+	return nil
+}
+
+func (store *MemoryConfigStore) SetStatsProjects(ctx context.Context, projects []StatsProject) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.config == nil {
+		store.config = &ServerConfig{}
+	}
+	store.config.Projects = append([]StatsProject(nil), projects...)
+	return nil
+}
+
+type MemoryUpdateStore struct {
+	mu      sync.RWMutex
+	updates []LanguageUpdate
+}
+
+func (store *MemoryUpdateStore) Add(update LanguageUpdate) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.updates = append(store.updates, update)
+}
+
+func (store *MemoryUpdateStore) List(ctx context.Context) ([]LanguageUpdate, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return append([]LanguageUpdate(nil), store.updates...), nil
+}
+
+type MemorySnippetStore struct {
+	mu       sync.RWMutex
+	snippets map[string]Snippet
+}
+
+func snippetExpired(snippet Snippet) bool {
+	return snippet.ExpiresAt != nil && !snippet.ExpiresAt.After(time.Now())
+}
+
+func (store *MemorySnippetStore) Get(ctx context.Context, id string) (*Snippet, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	snippet, ok := store.snippets[id]
+	if !ok || snippetExpired(snippet) {
+		return nil, ErrNotFound
+	}
+	return &snippet, nil
+}
+
+func (store *MemorySnippetStore) FindByHash(ctx context.Context, hash string) (*Snippet, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for _, snippet := range store.snippets {
+		if snippet.Hash == hash && !snippetExpired(snippet) {
+			return &snippet, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (store *MemorySnippetStore) Insert(ctx context.Context, snippet Snippet) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, exists := store.snippets[snippet.ID]; exists {
+		return ErrDuplicateID
+	}
+	store.snippets[snippet.ID] = snippet
+	return nil
+}
+
+func (store *MemorySnippetStore) SetExpiry(ctx context.Context, id string, expiresAt *time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	snippet, ok := store.snippets[id]
+	if !ok {
+		return ErrNotFound
+	}
+	snippet.ExpiresAt = expiresAt
+	store.snippets[id] = snippet
+	return nil
+}
+
+type MemoryStatsHistoryStore struct {
+	mu        sync.RWMutex
+	snapshots []StatsSnapshot
+}
+
+func (store *MemoryStatsHistoryStore) Record(ctx context.Context, snapshot StatsSnapshot) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i := range store.snapshots {
+		if store.snapshots[i].Project == snapshot.Project && store.snapshots[i].Date == snapshot.Date {
+			store.snapshots[i] = snapshot
+			return nil
+		}
+	}
+	store.snapshots = append(store.snapshots, snapshot)
+	sort.Slice(store.snapshots, func(i, j int) bool {
+		return store.snapshots[i].Date < store.snapshots[j].Date
+	})
+	return nil
+}
+
+func (store *MemoryStatsHistoryStore) Range(ctx context.Context, project string, from string, to string) ([]StatsSnapshot, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	var snapshots []StatsSnapshot
+	for _, snapshot := range store.snapshots {
+		if snapshot.Project == project && snapshot.Date >= from && snapshot.Date <= to {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots, nil
+}
+
+func (store *MemoryStatsHistoryStore) LastBefore(ctx context.Context, project string, date string) (*StatsSnapshot, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	for i := len(store.snapshots) - 1; i >= 0; i-- {
+		snapshot := store.snapshots[i]
+		if snapshot.Project == project && snapshot.Date < date {
+			return &snapshot, nil
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func NewMongoStores(collections *Collections) *Stores {
+	stores := &Stores{
+		Releases:     &mongoReleaseStore{collections.Releases},
+		Commits:      &mongoCommitStore{collections.Commits},
+		Config:       &mongoConfigStore{collections.Config},
+		Updates:      &mongoUpdateStore{collections.Updates},
+		Snippets:     &mongoSnippetStore{collections.Snippets},
+		StatsHistory: &mongoStatsHistoryStore{collections.StatsHistory},
+	}
+	if collections.CompileCache != nil {
+		stores.CompileResults = &mongoCompileResultStore{collections.CompileCache}
+	}
+	return stores
+}
+
+type mongoReleaseStore struct {
+	collection *mongo.Collection
+}
+
+var publishedRelease = bson.M{"draft": bson.M{"$ne": true}}
+
+func (store *mongoReleaseStore) List(ctx context.Context, query ReleaseQuery) ([]LanguageRelease, error) {
+	filter := bson.M{}
+	if !query.IncludeDrafts {
+		filter["draft"] = publishedRelease["draft"]
+	}
+	if query.ReleaseIDs != nil {
+		filter["releaseID"] = bson.M{"$in": query.ReleaseIDs}
+	}
+	fileFilter := bson.M{}
+	for field, value := range map[string]string{
+		"platform":     query.Platform,
+		"architecture": query.Architecture,
+		"target":       query.Target} {
+		if value != "" {
+			fileFilter[field] = value
+		}
+	}
+	if len(fileFilter) > 0 {
+		filter["files"] = bson.M{"$elemMatch": fileFilter}
+	}
+	findOptions := options.Find()
+	if query.WithoutContent {
+		findOptions.SetProjection(bson.M{"content": 0})
+	}
+	cur, err := store.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var releases []LanguageRelease
+	for cur.Next(ctx) {
+		var release LanguageRelease
+		if err := cur.Decode(&release); err != nil {
+			log.Println("Error while decoding bson: ", err)
+			continue
+		}
+		releases = append(releases, release)
+	}
+	return releases, cur.Err()
+}
+
+func (store *mongoReleaseStore) Get(ctx context.Context, releaseID string) (*LanguageRelease, error) {
+	var release LanguageRelease
+	err := store.collection.FindOne(ctx, bson.M{"releaseID": releaseID}).Decode(&release)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+func (store *mongoReleaseStore) Count(ctx context.Context) (int64, error) {
+	return store.collection.CountDocuments(ctx, publishedRelease)
+}
+
+func (store *mongoReleaseStore) IncrementDownloads(ctx context.Context, releaseID string, fileID string) error {
+	updateRes, err := store.collection.UpdateOne(ctx,
+		bson.M{"releaseID": releaseID, "files.id": fileID},
+		bson.M{"$inc": bson.M{"files.$.downloads": 1}})
+	if err != nil {
+		return err
+	}
+	if updateRes.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Create retries when another release took the same index meanwhile, which
+// the unique index on index rejects
+func (store *mongoReleaseStore) Create(ctx context.Context, release LanguageRelease) (*LanguageRelease, error) {
+	if release.Files == nil {
+		release.Files = []ReleaseFile{}
+	}
+	for attempt := 0; ; attempt++ {
+		var last LanguageRelease
+		err := store.collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"index": -1})).Decode(&last)
+		if err == nil {
+			release.Index = last.Index + 1
+		} else if err == mongo.ErrNoDocuments {
+			release.Index = 0
+		} else {
+			return nil, err
+		}
+		_, err = store.collection.InsertOne(ctx, release)
+		if err == nil {
+			return &release, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		count, countErr := store.collection.CountDocuments(ctx, bson.M{"releaseID": release.ReleaseID})
+		if countErr != nil {
+			return nil, countErr
+		}
+		if count > 0 {
+			return nil, ErrDuplicateID
+		}
+		if attempt == 4 {
+			return nil, err
+		}
+	}
+}
+
+// updateRelease applies the update to the release, returning ErrNotFound if
+// nothing matched the filter
+func (store *mongoReleaseStore) updateRelease(ctx context.Context, filter bson.M, update bson.M) error {
+	updateRes, err := store.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if updateRes.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *mongoReleaseStore) Update(ctx context.Context, releaseID string, details ReleaseDetails) error {
+	return store.updateRelease(ctx, bson.M{"releaseID": releaseID}, bson.M{"$set": bson.M{
+		"version":   details.Version,
+		"title":     details.Title,
+		"content":   details.Content,
+		"updatedAt": releaseUpdateTime()}})
+}
+
+func (store *mongoReleaseStore) SetDraft(ctx context.Context, releaseID string, draft bool) error {
+	return store.updateRelease(ctx, bson.M{"releaseID": releaseID}, bson.M{"$set": bson.M{
+		"draft":     draft,
+		"updatedAt": releaseUpdateTime()}})
+}
+
+func (store *mongoReleaseStore) Delete(ctx context.Context, releaseID string) error {
+	deleteRes, err := store.collection.DeleteOne(ctx, bson.M{"releaseID": releaseID})
+	if err != nil {
+		return err
+	}
+	if deleteRes.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *mongoReleaseStore) SetFile(ctx context.Context, releaseID string, file ReleaseFile) error {
+	err := store.updateRelease(ctx, bson.M{"releaseID": releaseID, "files.id": file.Id}, bson.M{"$set": bson.M{
+		"files.$.platform":     file.Platform,
+		"files.$.target":       file.Target,
+		"files.$.architecture": file.Architecture,
+		"files.$.path":         file.Path,
+		"files.$.sha256":       file.SHA256,
+		"files.$.size":         file.Size,
+		"files.$.signature":    file.Signature,
+		"updatedAt":            releaseUpdateTime()}})
+	if err != ErrNotFound {
+		return err
+	}
+	file.Downloads = 0
+	return store.updateRelease(ctx, bson.M{"releaseID": releaseID, "files.id": bson.M{"$ne": file.Id}},
+		bson.M{"$push": bson.M{"files": file}, "$set": bson.M{"updatedAt": releaseUpdateTime()}})
+}
+
+func (store *mongoReleaseStore) RemoveFile(ctx context.Context, releaseID string, fileID string) error {
+	return store.updateRelease(ctx, bson.M{"releaseID": releaseID, "files.id": fileID},
+		bson.M{"$pull": bson.M{"files": bson.M{"id": fileID}}, "$set": bson.M{"updatedAt": releaseUpdateTime()}})
+}
+
+type mongoCommitStore struct {
+	collection *mongo.Collection
+}
+
+func (store *mongoCommitStore) Add(ctx context.Context, commits []NewCommit) error {
+	var commitVals bson.A
+	for i := 0; i < len(commits); i++ {
+		commitVals = append(commitVals, bson.M{
+			"id":         commits[i].Id,
+			"title":      commits[i].Title,
+			"message":    commits[i].Message,
+			"author":     commits[i].Author,
+			"repository": commits[i].Repository,
+			"site":       commits[i].Site,
+			"timestamp":  commits[i].Timestamp,
+			"ref":        commits[i].Ref,
+		})
+	}
+	_, err := store.collection.InsertMany(ctx, commitVals)
+	return err
+}
+
+func (store *mongoCommitStore) Latest(ctx context.Context) (*NewCommit, error) {
+	var commit NewCommit
+	err := store.collection.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"$natural": -1})).Decode(&commit)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &commit, nil
+}
+
+func (store *mongoCommitStore) ListByRepository(ctx context.Context, repository string) ([]NewCommit, error) {
+	cur, err := store.collection.Find(ctx, bson.M{"repository": bson.M{
+		"$regex": "(^|/)" + regexp.QuoteMeta(repository) + "$"}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var commits []NewCommit
+	for cur.Next(ctx) {
+		var commit NewCommit
+		if err := cur.Decode(&commit); err != nil {
+			log.Println("Error while decoding bson: ", err)
+			continue
+		}
+		commits = append(commits, commit)
+	}
+	return commits, cur.Err()
+}
+
+type mongoConfigStore struct {
+	collection *mongo.Collection
+}
+
+func (store *mongoConfigStore) Get(ctx context.Context) (*ServerConfig, error) {
+	var config ServerConfig
+	err := store.collection.FindOne(ctx, bson.M{}).Decode(&config)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (store *mongoConfigStore) SetWakatimeTokens(ctx context.Context, tokens WakatimeTokens, previousRefreshToken string) error {
+	filter := bson.M{}
+	if previousRefreshToken != "" {
+		filter["wakatime.refreshToken"] = previousRefreshToken
+	}
+	updateRes, err := store.collection.UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{
+			"wakatime.accessToken":  tokens.AccessToken,
+			"wakatime.refreshToken": tokens.RefreshToken,
+			"wakatime.expiresAt":    tokens.ExpiresAt}})
+	if err != nil {
+		return err
+	}
+	if updateRes.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (store *mongoConfigStore) SetWakatime(ctx context.Context, wakatime WakatimeConfig) error {
+	_, err := store.collection.UpdateOne(ctx, bson.M{}, bson.M{"$set": bson.M{"wakatime": wakatime}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+func (store *mongoConfigStore) SetStatsProjects(ctx context.Context, projects []StatsProject) error {
+	_, err := store.collection.UpdateOne(ctx, bson.M{}, bson.M{"$set": bson.M{"projects": projects}},
+		options.Update().SetUpsert(true))
+	return err
+}
+
+type mongoUpdateStore struct {
+	collection *mongo.Collection
+}
+
+func (store *mongoUpdateStore) List(ctx context.Context) ([]LanguageUpdate, error) {
+	cur, err := store.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var updates []LanguageUpdate
+	for cur.Next(ctx) {
+		var update LanguageUpdate
+		if err := cur.Decode(&update); err != nil {
+			log.Println("Error while decoding bson: ", err)
+			continue
+		}
+		updates = append(updates, update)
+	}
+	return updates, cur.Err()
+}
+
+type mongoSnippetStore struct {
+	collection *mongo.Collection
+}
+
+func notExpired() bson.A {
+	return bson.A{
+		bson.M{"expiresAt": bson.M{"$exists": false}},
+		bson.M{"expiresAt": bson.M{"$gt": time.Now().UTC()}},
+	}
+}
+
+func (store *mongoSnippetStore) findOne(ctx context.Context, filter bson.M) (*Snippet, error) {
+	filter["$or"] = notExpired()
+	var snippet Snippet
+	err := store.collection.FindOne(ctx, filter).Decode(&snippet)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snippet, nil
+}
+
+func (store *mongoSnippetStore) Get(ctx context.Context, id string) (*Snippet, error) {
+	return store.findOne(ctx, bson.M{"id": id})
+}
+
+func (store *mongoSnippetStore) FindByHash(ctx context.Context, hash string) (*Snippet, error) {
+	return store.findOne(ctx, bson.M{"hash": hash})
+}
+
+func (store *mongoSnippetStore) Insert(ctx context.Context, snippet Snippet) error {
+	_, err := store.collection.InsertOne(ctx, snippet)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateID
+	}
+	return err
+}
+
+func (store *mongoSnippetStore) SetExpiry(ctx context.Context, id string, expiresAt *time.Time) error {
+	update := bson.M{"$unset": bson.M{"expiresAt": ""}}
+	if expiresAt != nil {
+		update = bson.M{"$set": bson.M{"expiresAt": *expiresAt}}
+	}
+	_, err := store.collection.UpdateOne(ctx, bson.M{"id": id}, update)
+	return err
+}
+
+type mongoStatsHistoryStore struct {
+	collection *mongo.Collection
+}
+
+func (store *mongoStatsHistoryStore) Record(ctx context.Context, snapshot StatsSnapshot) error {
+	_, err := store.collection.ReplaceOne(ctx,
+		bson.M{"project": snapshot.Project, "date": snapshot.Date}, snapshot,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+func (store *mongoStatsHistoryStore) Range(ctx context.Context, project string, from string, to string) ([]StatsSnapshot, error) {
+	cur, err := store.collection.Find(ctx,
+		bson.M{"project": project, "date": bson.M{"$gte": from, "$lte": to}},
+		options.Find().SetSort(bson.M{"date": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var snapshots []StatsSnapshot
+	for cur.Next(ctx) {
+		var snapshot StatsSnapshot
+		if err := cur.Decode(&snapshot); err != nil {
+			log.Println("Error while decoding bson: ", err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, cur.Err()
+}
+
+func (store *mongoStatsHistoryStore) LastBefore(ctx context.Context, project string, date string) (*StatsSnapshot, error) {
+	var snapshot StatsSnapshot
+	err := store.collection.FindOne(ctx, bson.M{"project": project, "date": bson.M{"$lt": date}},
+		options.FindOne().SetSort(bson.M{"date": -1})).Decode(&snapshot)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+type CachedCompileResult struct {
+	Key       string              `bson:"key"`
+	Result    SystemCompileResult `bson:"result"`
+	CreatedAt string              `bson:"createdAt"`
+}
+
+type mongoCompileResultStore struct {
+	collection *mongo.Collection
+}
+
+func (store *mongoCompileResultStore) Get(ctx context.Context, key string) (*SystemCompileResult, error) {
+	var stored CachedCompileResult
+	err := store.collection.FindOne(ctx, bson.M{"key": key}).Decode(&stored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stored.Result, nil
+}
+
+func (store *mongoCompileResultStore) Put(ctx context.Context, key string, result SystemCompileResult) error {
+	_, err := store.collection.UpdateOne(ctx, bson.M{"key": key},
+		bson.M{"$set": CachedCompileResult{Key: key, Result: result, CreatedAt: time.Now().UTC().Format(time.RFC3339)}},
+		options.Update().SetUpsert(true))
+	return err
+}
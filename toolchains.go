@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+const defaultToolchainID = "default"
+
+// ToolchainRegistry keeps track of the compiler releases that are installed on
+// disk. Each release is expected at TOOLCHAINS_DIR/<releaseID>/qat, and when no
+// release is installed the compiler passed on the command line or found in
+// PATH is used instead.
+type ToolchainRegistry struct {
+	releases   ReleaseStore
+	dir        string
+	mu         sync.RWMutex
+	toolchains []Toolchain
+}
+
+func NewToolchainRegistry(releases ReleaseStore, dir string) *ToolchainRegistry {
+	registry := &ToolchainRegistry{releases: releases, dir: dir}
+	registry.Refresh()
+	return registry
+}
+
+func (registry *ToolchainRegistry) fallback() Toolchain {
+	return Toolchain{ReleaseID: defaultToolchainID, IsDefault: true, Binary: compilerBinary()}
+}
+
+func (registry *ToolchainRegistry) Refresh() {
+	if registry.dir == "" {
+		return
+	}
+	releases, err := registry.releases.List(context.Background(), ReleaseQuery{WithoutContent: true})
+	if err != nil {
+		log.Println("Error while finding releases for toolchains: ", err)
+		return
+	}
+	sortReleases(releases)
+	var toolchains []Toolchain
+	for _, release := range releases {
+		binary := path.Join(registry.dir, release.ReleaseID, "qat")
+		info, err := os.Stat(binary)
+		if err != nil || info.IsDir() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		toolchains = append(toolchains, Toolchain{
+			ReleaseID:    release.ReleaseID,
+			Version:      release.Version.Value,
+			IsPrerelease: release.Version.IsPrerelease,
+			Prerelease:   release.Version.Prerelease,
+			Binary:       binary,
+		})
+	}
+	defaultIndex := 0
+	for i := range toolchains {
+		if !toolchains[i].IsPrerelease {
+			defaultIndex = i
+			break
+		}
+	}
+	if len(toolchains) > 0 {
+		toolchains[defaultIndex].IsDefault = true
+	}
+	registry.mu.Lock()
+	registry.toolchains = toolchains
+	registry.mu.Unlock()
+	log.Printf("Found %d installed toolchains", len(toolchains))
+}
+
+func (registry *ToolchainRegistry) StartRefreshing(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			registry.Refresh()
+		}
+	}()
+}
+
+func (registry *ToolchainRegistry) List() []Toolchain {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	if len(registry.toolchains) == 0 {
+		return []Toolchain{registry.fallback()}
+	}
+	return append([]Toolchain(nil), registry.toolchains...)
+}
+
+// Resolve finds the toolchain matching the requested release ID or version.
+// An empty name resolves to the latest stable toolchain.
+func (registry *ToolchainRegistry) Resolve(name string) (Toolchain, bool) {
+	for _, toolchain := range registry.List() {
+		if name == "" && toolchain.IsDefault {
+			return toolchain, true
+		}
+		if name != "" && (name == toolchain.ReleaseID ||
+			(!toolchain.IsPrerelease && name == toolchain.Version) ||
+			(toolchain.IsPrerelease && name == toolchain.Version+"-"+toolchain.Prerelease)) {
+			return toolchain, true
+		}
+	}
+	return Toolchain{}, false
+}
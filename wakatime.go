@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// legacyWakatimeRedirectURI was used for the tokens set up by hand before the
+// server could authorize itself, so refreshing keeps working for them
+const legacyWakatimeRedirectURI = "https://qat.dev"
+
+// wakatimeRedirectURI is the callback of the authorization flow, from
+// WAKATIME_REDIRECT_URI or else PUBLIC_URL. It is empty if neither is set.
+func wakatimeRedirectURI() string {
+	if uri := os.Getenv("WAKATIME_REDIRECT_URI"); uri != "" {
+		return uri
+	}
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/") + "/admin/wakatime/callback"
+	}
+	return ""
+}
+
+var errNoWakatimeRedirectURI = errors.New("PUBLIC_URL or WAKATIME_REDIRECT_URI has to be set for Wakatime to redirect back to the server")
+
+// parseWakatimeTokens decodes the response of the Wakatime token endpoint,
+// which is form encoded unless JSON was asked for. The expiry is returned in
+// RFC 3339 form whether the response had expires_at or only expires_in.
+func parseWakatimeTokens(contentType string, body []byte) (*WakatimeTokens, error) {
+	values := map[string]string{}
+	if strings.Contains(contentType, "json") || strings.HasPrefix(strings.TrimSpace(string(body)), "{") {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("could not decode token response: %w", err)
+		}
+		for key, value := range raw {
+			switch v := value.(type) {
+			case string:
+				values[key] = v
+			case float64:
+				values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	} else {
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("could not decode token response: %w", err)
+		}
+		for key := range form {
+			values[key] = form.Get(key)
+		}
+	}
+	tokens := &WakatimeTokens{
+		AccessToken:  values["access_token"],
+		RefreshToken: values["refresh_token"],
+	}
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		return nil, errors.New("token response is missing the access or refresh token")
+	}
+	if expiresAt, err := time.Parse(time.RFC3339, values["expires_at"]); err == nil {
+		tokens.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	} else if expiresIn, err := strconv.ParseFloat(values["expires_in"], 64); err == nil {
+		tokens.ExpiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second).UTC().Format(time.RFC3339)
+	} else {
+		return nil, errors.New("token response has no valid expiry")
+	}
+	return tokens, nil
+}
+
+// requestWakatimeTokens posts the form to the Wakatime token endpoint and
+// returns the tokens in its response.
+func requestWakatimeTokens(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (*WakatimeTokens, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("could not read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token request failed with status code %d", resp.StatusCode)
+	}
+	return parseWakatimeTokens(resp.Header.Get("Content-Type"), body)
+}
+
+// WakatimeTokenManager keeps the Wakatime access token in the server config
+// fresh. It checks the expiry periodically and refreshes the token once it is
+// within refreshBefore of expiring, retrying failed refreshes with backoff.
+// Failures are logged and reported through Status, never fatal.
+type WakatimeTokenManager struct {
+	configs       ConfigStore
+	client        *http.Client
+	checkInterval time.Duration
+	refreshBefore time.Duration
+	maxAttempts   int
+	backoff       time.Duration
+	mu            sync.Mutex
+	status        WakatimeRefreshStatus
+}
+
+func NewWakatimeTokenManager(configs ConfigStore) *WakatimeTokenManager {
+	return &WakatimeTokenManager{
+		configs:       configs,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		checkInterval: time.Duration(envInt("WAKATIME_CHECK_MINUTES", 60)) * time.Minute,
+		refreshBefore: time.Duration(envInt("WAKATIME_REFRESH_BEFORE_HOURS", 24)) * time.Hour,
+		maxAttempts:   envInt("WAKATIME_REFRESH_ATTEMPTS", 5),
+		backoff:       5 * time.Second,
+	}
+}
+
+func (manager *WakatimeTokenManager) Start() {
+	go func() {
+		for {
+			manager.check(context.Background())
+			manager.mu.Lock()
+			manager.status.NextCheck = time.Now().Add(manager.checkInterval).UTC().Format(time.RFC3339)
+			manager.mu.Unlock()
+			time.Sleep(manager.checkInterval)
+		}
+	}()
+}
+
+func (manager *WakatimeTokenManager) Status() WakatimeRefreshStatus {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	return manager.status
+}
+
+func (manager *WakatimeTokenManager) fail(message string) {
+	log.Println(message)
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.status.LastError = message
+	manager.status.ConsecutiveFailures++
+}
+
+func (manager *WakatimeTokenManager) check(ctx context.Context) {
+	config, err := manager.configs.Get(ctx)
+	if err != nil {
+		manager.fail("Could not retrieve server config for refreshing the Wakatime token")
+		return
+	}
+	expiry, err := time.Parse(time.RFC3339, config.Wakatime.ExpiresAt)
+	manager.mu.Lock()
+	manager.status.ExpiresAt = config.Wakatime.ExpiresAt
+	manager.mu.Unlock()
+	if err == nil && time.Until(expiry) > manager.refreshBefore {
+		return
+	}
+	if config.Wakatime.RefreshToken == "" {
+		manager.fail("No Wakatime refresh token is configured")
+		return
+	}
+	backoff := manager.backoff
+	for attempt := 1; attempt <= manager.maxAttempts; attempt++ {
+		err = manager.Refresh(ctx, config.Wakatime)
+		if err == nil {
+			return
+		}
+		manager.fail(fmt.Sprintf("Refreshing the Wakatime token failed on attempt %d: %s", attempt, err))
+		if attempt < manager.maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+// Refresh exchanges the refresh token for new tokens and stores them. The
+// store only accepts them if the refresh token was not changed meanwhile.
+func (manager *WakatimeTokenManager) Refresh(ctx context.Context, wakatime WakatimeConfig) error {
+	manager.mu.Lock()
+	manager.status.LastAttempt = time.Now().UTC().Format(time.RFC3339)
+	manager.mu.Unlock()
+	redirectURI := wakatimeRedirectURI()
+	if redirectURI == "" {
+		redirectURI = legacyWakatimeRedirectURI
+	}
+	tokens, err := requestWakatimeTokens(ctx, manager.client, wakatime.RefreshURL, url.Values{
+		"client_id":     {wakatime.ClientID},
+		"client_secret": {wakatime.ClientSecret},
+		"redirect_uri":  {redirectURI},
+		"refresh_token": {wakatime.RefreshToken},
+		"grant_type":    {"refresh_token"},
+	})
+	if err != nil {
+		return err
+	}
+	err = manager.configs.SetWakatimeTokens(ctx, *tokens, wakatime.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("could not store the refreshed tokens: %w", err)
+	}
+	log.Println("Refreshed the Wakatime token, which now expires at", tokens.ExpiresAt)
+	manager.recordSuccess(*tokens)
+	return nil
+}
+
+func (manager *WakatimeTokenManager) recordSuccess(tokens WakatimeTokens) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.status.LastSuccess = time.Now().UTC().Format(time.RFC3339)
+	manager.status.LastError = ""
+	manager.status.ConsecutiveFailures = 0
+	manager.status.ExpiresAt = tokens.ExpiresAt
+}
+
+// WakatimeAuthorizer runs the OAuth authorization code flow with Wakatime, so
+// that the server can be authorized without seeding tokens in the database.
+// States handed out with the authorization URL are single use and expire.
+type WakatimeAuthorizer struct {
+	configs ConfigStore
+	tokens  *WakatimeTokenManager
+	client  *http.Client
+	mu      sync.Mutex
+	states  map[string]time.Time
+}
+
+func NewWakatimeAuthorizer(configs ConfigStore, tokens *WakatimeTokenManager) *WakatimeAuthorizer {
+	return &WakatimeAuthorizer{
+		configs: configs,
+		tokens:  tokens,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		states:  make(map[string]time.Time),
+	}
+}
+
+// clientConfig returns the stored Wakatime config, falling back to the
+// environment for the client credentials and endpoints that are not stored.
+func (authorizer *WakatimeAuthorizer) clientConfig(ctx context.Context) WakatimeConfig {
+	var wakatime WakatimeConfig
+	if config, err := authorizer.configs.Get(ctx); err == nil {
+		wakatime = config.Wakatime
+	}
+	if wakatime.ClientID == "" {
+		wakatime.ClientID = os.Getenv("WAKATIME_CLIENT_ID")
+	}
+	if wakatime.ClientSecret == "" {
+		wakatime.ClientSecret = os.Getenv("WAKATIME_CLIENT_SECRET")
+	}
+	if wakatime.RefreshURL == "" {
+		wakatime.RefreshURL = os.Getenv("WAKATIME_TOKEN_URL")
+	}
+	if wakatime.RefreshURL == "" {
+		wakatime.RefreshURL = "https://wakatime.com/oauth/token"
+	}
+	return wakatime
+}
+
+func (authorizer *WakatimeAuthorizer) AuthorizationURL(ctx context.Context) (string, error) {
+	wakatime := authorizer.clientConfig(ctx)
+	if wakatime.ClientID == "" || wakatime.ClientSecret == "" {
+		return "", errors.New("Wakatime client credentials are not configured")
+	}
+	redirectURI := wakatimeRedirectURI()
+	if redirectURI == "" {
+		return "", errNoWakatimeRedirectURI
+	}
+	state, err := randomID(32)
+	if err != nil {
+		return "", err
+	}
+	authorizer.mu.Lock()
+	for existing, expiry := range authorizer.states {
+		if time.Now().After(expiry) {
+			delete(authorizer.states, existing)
+		}
+	}
+	authorizer.states[state] = time.Now().Add(10 * time.Minute)
+	authorizer.mu.Unlock()
+	authorizeURL := os.Getenv("WAKATIME_AUTHORIZE_URL")
+	if authorizeURL == "" {
+		authorizeURL = "https://wakatime.com/oauth/authorize"
+	}
+	scopes := os.Getenv("WAKATIME_SCOPES")
+	if scopes == "" {
+		scopes = "read_stats"
+	}
+	return authorizeURL + "?" + url.Values{
+		"client_id":     {wakatime.ClientID},
+		"response_type": {"code"},
+		"redirect_uri":  {redirectURI},
+		"scope":         {scopes},
+		"state":         {state},
+	}.Encode(), nil
+}
+
+// Complete validates the state returned by Wakatime, exchanges the code for
+// tokens and stores them along with the client config used to get them.
+func (authorizer *WakatimeAuthorizer) Complete(ctx context.Context, state string, code string) error {
+	authorizer.mu.Lock()
+	expiry, ok := authorizer.states[state]
+	delete(authorizer.states, state)
+	authorizer.mu.Unlock()
+	if !ok || time.Now().After(expiry) {
+		return errors.New("Invalid or expired authorization state")
+	}
+	if code == "" {
+		return errors.New("No authorization code was provided")
+	}
+	redirectURI := wakatimeRedirectURI()
+	if redirectURI == "" {
+		return errNoWakatimeRedirectURI
+	}
+	wakatime := authorizer.clientConfig(ctx)
+	tokens, err := requestWakatimeTokens(ctx, authorizer.client, wakatime.RefreshURL, url.Values{
+		"client_id":     {wakatime.ClientID},
+		"client_secret": {wakatime.ClientSecret},
+		"redirect_uri":  {redirectURI},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+	})
+	if err != nil {
+		return err
+	}
+	wakatime.AccessToken = tokens.AccessToken
+	wakatime.RefreshToken = tokens.RefreshToken
+	wakatime.ExpiresAt = tokens.ExpiresAt
+	err = authorizer.configs.SetWakatime(ctx, wakatime)
+	if err != nil {
+		return fmt.Errorf("could not store the Wakatime tokens: %w", err)
+	}
+	log.Println("Authorized with Wakatime, the token expires at", tokens.ExpiresAt)
+	authorizer.tokens.recordSuccess(*tokens)
+	return nil
+}